@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIConfig habilita, no modo serve, a API HTTP para listar assets,
+// disparar coletas e baixar a última coleta de um asset.
+type APIConfig struct {
+	Listen   string `json:"listen"`              // Ex: "127.0.0.1:8080"
+	TokenEnv string `json:"token_env,omitempty"` // Variável com o bearer token (default: COLLECTOR_API_TOKEN)
+}
+
+const defaultAPITokenEnv = "COLLECTOR_API_TOKEN"
+
+// apiMaxRuns limita as execuções mantidas em memória para consulta.
+const apiMaxRuns = 100
+
+func (a *APIConfig) Validate() error {
+	if a == nil {
+		return nil
+	}
+	if strings.TrimSpace(a.Listen) == "" {
+		return errors.New("api.listen não pode ser vazio")
+	}
+	return nil
+}
+
+func (a *APIConfig) tokenEnv() string {
+	if a.TokenEnv != "" {
+		return a.TokenEnv
+	}
+	return defaultAPITokenEnv
+}
+
+// apiServer atende a API sobre o pool de workers do modo serve.
+type apiServer struct {
+	c      *collector
+	token  string
+	logger *slog.Logger
+
+	// Execuções disparadas pela API, para consulta de status
+	mu      sync.Mutex
+	runs    map[string]*apiRun
+	order   []string
+	wg      sync.WaitGroup
+	closing bool // Definido no encerramento; novas execuções são recusadas
+}
+
+type apiRun struct {
+	report *RunReport
+	done   chan struct{}
+}
+
+// newAPIServer lê o token da variável de ambiente; a API não sobe sem
+// token.
+func newAPIServer(c *collector, cfg *APIConfig, logger *slog.Logger) (*apiServer, error) {
+	token := os.Getenv(cfg.tokenEnv())
+	if token == "" {
+		return nil, fmt.Errorf("api: variável %s não definida", cfg.tokenEnv())
+	}
+	return &apiServer{
+		c:      c,
+		token:  token,
+		logger: logger,
+		runs:   make(map[string]*apiRun),
+	}, nil
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/assets", s.listAssets)
+	mux.HandleFunc("POST /api/runs", s.triggerRun)
+	mux.HandleFunc("GET /api/runs/{id}", s.runStatus)
+	mux.HandleFunc("GET /api/assets/{name}/latest", s.latestCapture)
+	return s.authenticate(mux)
+}
+
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "token inválido")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// close recusa novas execuções; as já aceitas continuam.
+func (s *apiServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closing = true
+}
+
+// begin reserva uma execução no WaitGroup, se o servidor não estiver
+// encerrando. O teste e o Add ficam sob s.mu para não concorrer com wait.
+func (s *apiServer) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.wg.Add(1)
+	return true
+}
+
+// wait recusa novas execuções e aguarda as disparadas pela API terminarem.
+func (s *apiServer) wait() {
+	s.close()
+	s.wg.Wait()
+}
+
+type apiAsset struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Port     int    `json:"port,omitempty"`
+	Vendor   string `json:"vendor"`
+	Protocol string `json:"protocol"`
+	Group    string `json:"group"`
+	Schedule string `json:"schedule,omitempty"`
+	Active   bool   `json:"active"`
+}
+
+func (s *apiServer) listAssets(w http.ResponseWriter, r *http.Request) {
+	assets := []apiAsset{}
+	for _, g := range s.c.current().cfg.Groups {
+		for _, a := range g.Assets {
+			protocol := strings.ToLower(strings.TrimSpace(a.Protocol))
+			if protocol == "" {
+				protocol = "ssh"
+			}
+			assets = append(assets, apiAsset{
+				Name:     a.Name,
+				Address:  a.Address,
+				Port:     a.Port,
+				Vendor:   normalizeVendor(g.Vendor),
+				Protocol: protocol,
+				Group:    g.DisplayName(),
+				Schedule: g.Schedule,
+				Active:   a.IsActive(),
+			})
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, assets)
+}
+
+// triggerRun dispara uma coleta de um asset ou de um grupo. Corpo:
+// {"asset": "SW1"} ou {"group": "core"}.
+func (s *apiServer) triggerRun(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Asset string `json:"asset"`
+		Group string `json:"group"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "corpo inválido: "+err.Error())
+		return
+	}
+	if (req.Asset == "") == (req.Group == "") {
+		writeAPIError(w, http.StatusBadRequest, "informe asset ou group")
+		return
+	}
+
+	st := s.c.current()
+	opts := runOptions{Trigger: "api", PerRunReport: true}
+	for gi, g := range st.cfg.Groups {
+		switch {
+		case req.Group != "" && g.DisplayName() == req.Group:
+			opts.Groups = append(opts.Groups, gi)
+		case req.Asset != "" && groupHasAsset(g, req.Asset):
+			opts.Groups = append(opts.Groups, gi)
+			opts.Assets = []string{req.Asset}
+		}
+	}
+	if len(opts.Groups) == 0 {
+		writeAPIError(w, http.StatusNotFound, "asset ou grupo não encontrado")
+		return
+	}
+
+	if !s.begin() {
+		writeAPIError(w, http.StatusServiceUnavailable, "coletor encerrando")
+		return
+	}
+	p, err := s.c.prepare(st, opts)
+	if err != nil {
+		s.wg.Done()
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	report := p.report
+	run := &apiRun{report: report, done: make(chan struct{})}
+	s.track(run)
+
+	go func() {
+		defer s.wg.Done()
+		defer close(run.done)
+		s.c.run(p)
+	}()
+
+	s.logger.Info("coleta disparada pela API", "run_id", report.RunID, "asset", req.Asset, "group", req.Group)
+	writeAPIJSON(w, http.StatusAccepted, map[string]string{
+		"run_id":     report.RunID,
+		"status":     "running",
+		"status_url": "/api/runs/" + report.RunID,
+	})
+}
+
+func groupHasAsset(g Group, name string) bool {
+	for _, a := range g.Assets {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// track registra a execução, descartando as mais antigas além de
+// apiMaxRuns.
+func (s *apiServer) track(run *apiRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[run.report.RunID] = run
+	s.order = append(s.order, run.report.RunID)
+	for len(s.order) > apiMaxRuns {
+		delete(s.runs, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// runStatus retorna o relatório da execução; enquanto ela está em
+// andamento, "assets" traz apenas os jobs já concluídos.
+func (s *apiServer) runStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	run, ok := s.runs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "execução não encontrada")
+		return
+	}
+
+	status := "finished"
+	select {
+	case <-run.done:
+	default:
+		status = "running"
+	}
+	writeAPIJSON(w, http.StatusOK, struct {
+		Status string     `json:"status"`
+		Report *RunReport `json:"report"`
+	}{status, run.report.Snapshot()})
+}
+
+// latestCapture devolve a coleta mais recente do asset, já descomprimida.
+// Coletas em modo split são remontadas no formato combinado.
+func (s *apiServer) latestCapture(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	cfg := s.c.current().cfg
+	var asset *Asset
+	for _, g := range cfg.Groups {
+		for i := range g.Assets {
+			if g.Assets[i].Name == name {
+				asset = &g.Assets[i]
+			}
+		}
+	}
+	if asset == nil {
+		writeAPIError(w, http.StatusNotFound, "asset não encontrado")
+		return
+	}
+
+	path, err := findPreviousCapture(cfg.BaseDir, nil, assetKey(asset.Name, asset.Address), nil)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if path == "" {
+		writeAPIError(w, http.StatusNotFound, "nenhuma coleta do asset")
+		return
+	}
+
+	var data []byte
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		data, err = readSplitCombined(path)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	} else {
+		data, err = readCaptureFile(path)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	contentType, ext := "text/plain; charset=utf-8", ".txt"
+	if isJSONCapture(path) {
+		contentType, ext = "application/json", ".json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", captureBase(filepath.Base(path))+ext))
+	w.Header().Set("X-Capture-File", filepath.Base(path))
+	_, _ = w.Write(data)
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIJSON(w, status, map[string]string{"error": msg})
+}
+
+// serveHTTP atende em ln e encerra o servidor quando ctx é cancelado,
+// aguardando as requisições em andamento. O canal retornado é fechado
+// depois do Shutdown, quando nenhum handler está mais em execução (Serve
+// retorna assim que o Shutdown começa).
+func serveHTTP(ctx context.Context, ln net.Listener, handler http.Handler, logger *slog.Logger) <-chan struct{} {
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	stopped := make(chan struct{})
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("erro no servidor HTTP", "listen", ln.Addr().String(), "error", err)
+		}
+	}()
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	return stopped
+}
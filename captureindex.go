@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// captureIndexName é o índice de coletas de cada diretório de dia. Como o
+// nome dos arquivos vem de output.filename_template, a comparação com a
+// coleta anterior e o prune localizam as coletas de um asset pelo índice, e
+// não pelo nome do arquivo.
+const captureIndexName = "captures.jsonl"
+
+type captureIndexEntry struct {
+	Asset    string    `json:"asset"`
+	Address  string    `json:"address"`
+	Vendor   string    `json:"vendor"`
+	Protocol string    `json:"protocol"`
+	RunID    string    `json:"run_id"`
+	Time     time.Time `json:"time"`
+	Capture  string    `json:"capture"`          // Arquivo combinado ou diretório split, relativo ao dia
+	Files    []string  `json:"files"`            // Todos os arquivos da coleta, relativos ao dia
+	Failed   []string  `json:"failed,omitempty"` // Comandos truncados ou com erro
+}
+
+// captureIndexMu serializa as escritas dos workers no índice.
+var captureIndexMu sync.Mutex
+
+func appendCaptureIndex(dayDir string, e captureIndexEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	captureIndexMu.Lock()
+	defer captureIndexMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(dayDir, captureIndexName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readCaptureIndex(dayDir string) ([]captureIndexEntry, error) {
+	f, err := os.Open(filepath.Join(dayDir, captureIndexName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []captureIndexEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e captureIndexEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.Capture != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// captureEntry monta a entrada do índice de uma coleta gravada.
+func captureEntry(job Job, c *capture, res *JobResult) captureIndexEntry {
+	e := captureIndexEntry{
+		Asset:    job.Asset.Name,
+		Address:  job.Asset.Address,
+		Vendor:   job.Vendor,
+		Protocol: job.Protocol,
+		RunID:    job.RunID,
+		Time:     c.Time,
+	}
+	for _, p := range []string{res.OutputFile, res.JSONFile, res.SplitDir, res.DiffFile} {
+		if p != "" {
+			e.Files = append(e.Files, filepath.Base(p))
+		}
+	}
+	for _, o := range c.Commands {
+		if !o.complete() {
+			e.Failed = append(e.Failed, o.Command)
+		}
+	}
+	e.Capture = filepath.Base(capturePath(res))
+	return e
+}
+
+// assetKey identifica um asset entre coletas (nome e endereço).
+func assetKey(name, address string) string {
+	return sanitize(name) + "__" + sanitize(address)
+}
+
+// dayCapture é uma coleta de um asset dentro de um diretório de dia.
+type dayCapture struct {
+	asset string    // assetKey
+	path  string    // Captura principal (arquivo combinado ou diretório split)
+	time  time.Time // Horário local da coleta; ordena as coletas
+	files []string  // Nomes de todos os arquivos da coleta no diretório
+	// Comandos truncados ou com erro; vazio em coletas fora do índice
+	failed []string
+}
+
+// commandFailed informa se cmd foi registrado como truncado ou com erro.
+func (c dayCapture) commandFailed(cmd string) bool {
+	key := commandKey(cmd)
+	return slices.ContainsFunc(c.failed, func(f string) bool { return commandKey(f) == key })
+}
+
+// listDayDirs retorna os diretórios YYYY-MM-DD de baseDir, do mais recente
+// para o mais antigo.
+func listDayDirs(baseDir string) ([]string, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", e.Name()); err == nil {
+			days = append(days, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	return days, nil
+}
+
+// dayCaptures lista as coletas de um diretório de dia a partir do índice.
+// Arquivos fora do índice (coletas anteriores ao índice) são reconhecidos
+// pelo nome legado NOME__IP__VENDOR__PROTO__HHMMSS ou pelo nome do
+// filename_template padrão, NOME__IP__VENDOR__PROTO__AAAAMMDD-HHMMSS__RUNID.
+func dayCaptures(dayDir string) ([]dayCapture, []os.DirEntry, error) {
+	entries, err := os.ReadDir(dayDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := readCaptureIndex(dayDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	present := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		present[e.Name()] = true
+	}
+
+	var captures []dayCapture
+	covered := make(map[string]bool)
+	for _, e := range index {
+		// Entradas cujas coletas já foram removidas pelo prune
+		if !present[e.Capture] {
+			continue
+		}
+		files := e.Files
+		if len(files) == 0 {
+			files = []string{e.Capture}
+		}
+		for _, f := range files {
+			covered[f] = true
+		}
+		captures = append(captures, dayCapture{
+			asset:  assetKey(e.Asset, e.Address),
+			path:   filepath.Join(dayDir, e.Capture),
+			time:   e.Time.Local(),
+			files:  files,
+			failed: e.Failed,
+		})
+	}
+
+	legacy := make(map[string]*dayCapture)
+	var order []string
+	for _, e := range entries {
+		name := e.Name()
+		if covered[name] || strings.HasPrefix(name, ".") {
+			continue
+		}
+		base := captureBase(name)
+		parts := strings.Split(base, "__")
+		if len(parts) < 5 {
+			continue
+		}
+		c, ok := legacy[base]
+		if !ok {
+			t, ok := legacyCaptureTime(filepath.Base(dayDir), parts[4])
+			if !ok {
+				continue
+			}
+			c = &dayCapture{asset: parts[0] + "__" + parts[1], time: t}
+			legacy[base] = c
+			order = append(order, base)
+		}
+		c.files = append(c.files, name)
+		if e.IsDir() || isCaptureFile(name) {
+			c.path = filepath.Join(dayDir, name)
+		}
+	}
+	for _, base := range order {
+		if c := legacy[base]; c.path != "" {
+			captures = append(captures, *c)
+		}
+	}
+	return captures, entries, nil
+}
+
+// legacyCaptureTime interpreta o horário, em hora local, do quinto campo do
+// nome de uma coleta fora do índice: HHMMSS (nome legado, relativo ao dia)
+// ou AAAAMMDD-HHMMSS (filename_template padrão).
+func legacyCaptureTime(day, field string) (time.Time, bool) {
+	if t, err := time.ParseInLocation("20060102-150405", field, time.Local); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02 150405", day+" "+field, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// captureExts são as extensões removidas do nome para identificar a coleta;
+// arquivos com a mesma base (captura, diff) pertencem à mesma coleta.
+var captureExts = []string{".gz", ".zst", ".txt", ".json", ".diff"}
+
+func captureBase(name string) string {
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, ext := range captureExts {
+			if strings.HasSuffix(name, ext) {
+				name = strings.TrimSuffix(name, ext)
+				trimmed = true
+			}
+		}
+	}
+	return name
+}
+
+// isCaptureFile reconhece o arquivo combinado, comprimido ou não.
+func isCaptureFile(name string) bool {
+	for _, ext := range []string{".txt", ".txt.gz", ".txt.zst"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
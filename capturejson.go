@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// captureDocument é a coleta no formato JSON (output.format "json" ou
+// "both"): metadados do asset e um registro por comando, para parsers que
+// precisam saber onde cada saída começa e termina.
+type captureDocument struct {
+	Asset            string          `json:"asset"`
+	Address          string          `json:"address"`
+	Vendor           string          `json:"vendor"`
+	Protocol         string          `json:"protocol"`
+	Group            string          `json:"group,omitempty"`
+	RunID            string          `json:"run_id,omitempty"`
+	CollectorVersion string          `json:"collector_version"`
+	StartedAt        time.Time       `json:"started_at"`
+	EndedAt          time.Time       `json:"ended_at"`
+	LegacyFallback   bool            `json:"legacy_fallback,omitempty"`
+	Normalized       bool            `json:"normalized"`
+	Commands         []commandRecord `json:"commands"`
+}
+
+type commandRecord struct {
+	Command    string    `json:"command"`
+	Output     string    `json:"output"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Truncated  bool      `json:"truncated"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// JSON monta o documento JSON da coleta.
+func (c *capture) JSON(job Job) ([]byte, error) {
+	doc := captureDocument{
+		Asset:            job.Asset.Name,
+		Address:          job.Asset.Address,
+		Vendor:           job.Vendor,
+		Protocol:         job.Protocol,
+		Group:            job.Group,
+		RunID:            job.RunID,
+		CollectorVersion: version,
+		StartedAt:        c.Time,
+		EndedAt:          c.End,
+		LegacyFallback:   c.LegacyFallback,
+		Normalized:       !job.Output.Raw,
+		Commands:         make([]commandRecord, 0, len(c.Commands)),
+	}
+	for _, cmd := range c.Commands {
+		doc.Commands = append(doc.Commands, commandRecord{
+			Command:    cmd.Command,
+			Output:     cmd.Output,
+			StartedAt:  cmd.Started,
+			DurationMs: cmd.Duration.Milliseconds(),
+			Truncated:  cmd.Truncated,
+			Error:      cmd.Error,
+		})
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// isJSONCapture reconhece a coleta JSON, comprimida ou não.
+func isJSONCapture(path string) bool {
+	for _, ext := range []string{".json", ".json.gz", ".json.zst"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonCommandOutput extrai de uma coleta JSON a saída de cmd.
+func jsonCommandOutput(path string, data []byte, cmd string) (string, bool, error) {
+	var doc captureDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", false, fmt.Errorf("%s: %w", path, err)
+	}
+	key := commandKey(cmd)
+	for _, rec := range doc.Commands {
+		if commandKey(rec.Command) == key {
+			return strings.Trim(rec.Output, "\n"), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// capturePath é a coleta usada para comparação e no índice: o arquivo
+// texto, o diretório split ou, na falta dos dois, o documento JSON.
+func capturePath(res *JobResult) string {
+	switch {
+	case res.OutputFile != "":
+		return res.OutputFile
+	case res.SplitDir != "":
+		return res.SplitDir
+	}
+	return res.JSONFile
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"golang.org/x/crypto/ssh"
+)
+
+// collector executa as coletas com um pool fixo de workers. O modo
+// one-shot faz uma única execução; o modo serve dispara uma execução por
+// agendamento sobre o mesmo pool.
+type collector struct {
+	cfgPath string
+	logger  *slog.Logger
+
+	// Configuração em uso; trocada por inteiro no reload. Cada execução
+	// usa o estado vigente quando começou
+	state atomic.Pointer[collectorState]
+
+	// Serializa os commits no git_archive de execuções concorrentes
+	archiveMu sync.Mutex
+
+	jobs     chan queuedJob
+	wg       sync.WaitGroup
+	poolSize int
+
+	// Assets com coleta em andamento, para não sobrepor execuções
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// collectorState é a configuração validada e o que é derivado dela.
+type collectorState struct {
+	cfg             *Config
+	hostKeyCallback ssh.HostKeyCallback
+	filename        *template.Template
+	archiveRepo     *git.Repository // nil se git_archive desabilitado
+}
+
+// queuedJob é um job na fila do pool e a execução à qual pertence.
+type queuedJob struct {
+	job    Job
+	key    string
+	st     *collectorState
+	report *RunReport
+	done   *sync.WaitGroup
+}
+
+// pendingRun é uma execução preparada: o RunID já é conhecido, mas os
+// jobs ainda não foram enfileirados.
+type pendingRun struct {
+	st     *collectorState
+	report *RunReport
+	opts   runOptions
+}
+
+// runOptions seleciona os assets de uma execução e o nome do relatório.
+type runOptions struct {
+	// Grupos incluídos (índices em cfg.Groups); vazio inclui todos
+	Groups []int
+	// Assets incluídos (nome); vazio inclui todos os dos grupos
+	Assets []string
+	// Origem da execução gravada no relatório ("schedule", "api")
+	Trigger string
+	// Grava run-report-<run_id>.json em vez de run-report.json, para que
+	// execuções do mesmo dia não sobrescrevam o relatório uma da outra
+	PerRunReport bool
+}
+
+// applyDefaults preenche os campos opcionais com os valores padrão.
+func (c *Config) applyDefaults() {
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = 30
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 5
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	}
+	if c.BaseDir == "" {
+		c.BaseDir = "./coletas"
+	}
+}
+
+// newCollector prepara o estado inicial a partir de cfg, que já deve estar
+// validada.
+func newCollector(cfgPath string, cfg *Config, logger *slog.Logger) (*collector, error) {
+	c := &collector{
+		cfgPath: cfgPath,
+		logger:  logger,
+		running: make(map[string]bool),
+	}
+	st, err := newCollectorState(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	c.state.Store(st)
+
+	if cfg.Metrics != nil && cfg.Metrics.TextfilePath != "" {
+		if err := metrics.restoreLastSuccess(cfg.Metrics.TextfilePath); err != nil {
+			logger.Warn("erro lendo métricas anteriores", "path", cfg.Metrics.TextfilePath, "error", err)
+		}
+	}
+	return c, nil
+}
+
+// newCollectorState prepara a verificação de chaves de host, o template do
+// nome das coletas e o repositório do git_archive.
+func newCollectorState(cfg *Config, logger *slog.Logger) (*collectorState, error) {
+	// Avisar sobre SSH legacy
+	if cfg.SSHLegacy != nil && cfg.SSHLegacy.Enabled {
+		logger.Warn("SSH legacy mode habilitado - algoritmos antigos/inseguros permitidos",
+			"kex", cfg.SSHLegacy.KexAlgorithms,
+			"ciphers", cfg.SSHLegacy.Ciphers,
+			"macs", cfg.SSHLegacy.MACs,
+		)
+	}
+
+	st := &collectorState{cfg: cfg}
+
+	// Preparar host key callback
+	var err error
+	st.hostKeyCallback, err = createHostKeyCallback(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("preparando verificação de chaves de host: %w", err)
+	}
+
+	st.filename, err = cfg.Output.filenameTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	// Abrir (ou criar) o repositório do git_archive
+	if cfg.GitArchive != nil {
+		st.archiveRepo, err = openGitArchive(cfg.GitArchive.Path)
+		if err != nil {
+			return nil, fmt.Errorf("abrindo repositório git_archive %s: %w", cfg.GitArchive.Path, err)
+		}
+		logger.Info("usando git_archive", "path", cfg.GitArchive.Path, "exclusive", cfg.GitArchive.Exclusive)
+	}
+	return st, nil
+}
+
+// current retorna o estado em uso.
+func (c *collector) current() *collectorState {
+	return c.state.Load()
+}
+
+// swap passa a usar cfg nas próximas execuções; as execuções em andamento
+// continuam com o estado anterior. apply (opcional) recebe o novo estado
+// antes da troca. Em caso de erro o estado não muda.
+func (c *collector) swap(cfg *Config, apply func(*collectorState) error) (*collectorState, error) {
+	st, err := newCollectorState(cfg, c.logger)
+	if err != nil {
+		return nil, err
+	}
+	if apply != nil {
+		if err := apply(st); err != nil {
+			return nil, err
+		}
+	}
+	c.state.Store(st)
+	return st, nil
+}
+
+// start inicia os workers. Após o cancelamento de ctx os workers continuam
+// drenando a fila para registrar os assets não coletados. O tamanho do
+// pool é fixado aqui e não muda com o reload.
+func (c *collector) start(ctx context.Context) {
+	c.poolSize = c.current().cfg.Concurrency
+	c.jobs = make(chan queuedJob, c.poolSize)
+	for i := 0; i < c.poolSize; i++ {
+		c.wg.Add(1)
+		go func(workerID int) {
+			defer c.wg.Done()
+			for q := range c.jobs {
+				res := c.execute(ctx, workerID, q)
+				metrics.observeJob(res)
+				q.report.Add(res)
+				c.release(q.key)
+				q.done.Done()
+			}
+		}(i)
+	}
+}
+
+// stop fecha a fila e aguarda os workers. Nenhuma execução pode estar em
+// andamento.
+func (c *collector) stop() {
+	close(c.jobs)
+	c.wg.Wait()
+}
+
+// execute coleta um asset e monta o seu resultado.
+func (c *collector) execute(ctx context.Context, workerID int, q queuedJob) JobResult {
+	job := q.job
+	res := JobResult{
+		Asset:    job.Asset.Name,
+		Address:  job.Asset.Address,
+		Vendor:   job.Vendor,
+		Protocol: job.Protocol,
+	}
+
+	select {
+	case <-ctx.Done():
+		c.logger.Warn("job cancelado", "worker_id", workerID, "asset", job.Asset.Name)
+		res.Status = statusCancelled
+		res.ErrorClass = classifyError(ctx.Err())
+		return res
+	default:
+	}
+
+	metrics.jobsStarted.add(1, job.Vendor, job.Protocol)
+	res.StartedAt = time.Now()
+	err := runJobWithRetry(ctx, job, q.st.cfg.MaxRetries, q.st.hostKeyCallback, &res)
+	res.DurationMs = time.Since(res.StartedAt).Milliseconds()
+	if err != nil {
+		res.Status = statusFailed
+		if errors.Is(err, context.Canceled) {
+			res.Status = statusCancelled
+		}
+		res.ErrorClass = classifyError(err)
+		res.Error = err.Error()
+		c.logger.Error("job falhou",
+			"asset", job.Asset.Name,
+			"vendor", job.Vendor,
+			"address", job.Asset.Address,
+			"protocol", job.Protocol,
+			"error", err,
+		)
+	} else {
+		res.Status = statusSuccess
+		c.logger.Info("job concluído",
+			"asset", job.Asset.Name,
+			"vendor", job.Vendor,
+			"address", job.Asset.Address,
+			"protocol", job.Protocol,
+		)
+	}
+	return res
+}
+
+// acquire marca o asset como em coleta; retorna false se já houver uma
+// coleta dele em andamento.
+func (c *collector) acquire(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running[key] {
+		return false
+	}
+	c.running[key] = true
+	return true
+}
+
+func (c *collector) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.running, key)
+}
+
+// Run executa uma coleta dos assets selecionados em opts: enfileira os
+// jobs no pool, aguarda a conclusão, faz o commit do git_archive e grava o
+// relatório no diretório do dia. Retorna erro apenas se a execução não
+// pôde começar.
+func (c *collector) Run(opts runOptions) (*RunReport, error) {
+	return c.runWith(c.current(), opts)
+}
+
+// runWith executa a coleta com um estado específico (opts.Groups se refere
+// aos grupos de st.cfg).
+func (c *collector) runWith(st *collectorState, opts runOptions) (*RunReport, error) {
+	p, err := c.prepare(st, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.run(p)
+	return p.report, nil
+}
+
+// prepare cria o diretório do dia e o relatório da execução, cujo RunID já
+// pode ser informado antes de a coleta começar.
+func (c *collector) prepare(st *collectorState, opts runOptions) (*pendingRun, error) {
+	// Criar diretório de saída com data
+	dayDir := time.Now().Format("2006-01-02")
+	outDir := filepath.Join(st.cfg.BaseDir, dayDir)
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, fmt.Errorf("criando diretório %s: %w", outDir, err)
+	}
+
+	report := newRunReport(c.cfgPath, outDir)
+	report.Trigger = opts.Trigger
+	return &pendingRun{st: st, report: report, opts: opts}, nil
+}
+
+// run executa a coleta de uma execução preparada.
+func (c *collector) run(p *pendingRun) {
+	st, report, opts := p.st, p.report, p.opts
+	cfg := st.cfg
+	outDir := report.OutputDir
+
+	c.logger.Info("iniciando coleta",
+		"run_id", report.RunID,
+		"trigger", opts.Trigger,
+		"config", c.cfgPath,
+		"output_dir", outDir,
+		"concurrency", cfg.Concurrency,
+		"timeout", cfg.TimeoutSeconds,
+		"max_retries", cfg.MaxRetries,
+		"ssh_legacy", cfg.SSHLegacy != nil && cfg.SSHLegacy.Enabled,
+	)
+
+	var done sync.WaitGroup
+	c.enqueue(st, opts, outDir, report, &done)
+
+	// Aguardar conclusão
+	done.Wait()
+
+	report.Finish()
+
+	if st.archiveRepo != nil {
+		c.archiveMu.Lock()
+		hash, changed, err := commitGitArchive(st.archiveRepo, cfg.GitArchive, report.Assets, report.FinishedAt)
+		c.archiveMu.Unlock()
+		switch {
+		case err != nil:
+			c.logger.Error("erro gravando commit no git_archive", "path", cfg.GitArchive.Path, "error", err)
+		case hash == "":
+			c.logger.Info("git_archive sem alterações", "path", cfg.GitArchive.Path)
+		default:
+			report.SetArchiveCommit(hash, changed)
+			c.logger.Info("commit gravado no git_archive", "path", cfg.GitArchive.Path, "commit", hash, "changed", changed)
+		}
+	}
+
+	var hostKeyMismatches []string
+	for _, res := range report.Assets {
+		if res.ErrorClass == "host_key_mismatch" {
+			hostKeyMismatches = append(hostKeyMismatches, res.Asset)
+		}
+	}
+	if len(hostKeyMismatches) > 0 {
+		c.logger.Error("ATENÇÃO: chaves de host divergentes do known_hosts (possível MITM ou equipamento trocado)",
+			"assets", hostKeyMismatches,
+			"known_hosts", cfg.KnownHostsFile,
+		)
+	}
+
+	name := "run-report"
+	if opts.PerRunReport {
+		name += "-" + report.RunID
+	}
+	if err := report.Write(outDir, name, cfg.ReportCSV); err != nil {
+		c.logger.Error("erro gravando relatório", "dir", outDir, "error", err)
+	}
+	if cfg.Metrics != nil && cfg.Metrics.TextfilePath != "" {
+		if err := metrics.writeTextfile(cfg.Metrics.TextfilePath); err != nil {
+			c.logger.Error("erro gravando métricas", "path", cfg.Metrics.TextfilePath, "error", err)
+		}
+	}
+}
+
+// enqueue resolve os assets selecionados em jobs e os coloca na fila do
+// pool. Assets inativos, sem senha ou já em coleta entram direto no
+// relatório.
+func (c *collector) enqueue(st *collectorState, opts runOptions, outDir string, report *RunReport, done *sync.WaitGroup) {
+	cfg := st.cfg
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	archivePath, archiveOnly := "", false
+	if cfg.GitArchive != nil {
+		archivePath, archiveOnly = cfg.GitArchive.Path, cfg.GitArchive.Exclusive
+	}
+
+	totalAssets := 0
+	activeAssets := 0
+	inactiveAssets := 0
+	legacyAssets := 0
+	busyAssets := 0
+
+	for gi, g := range cfg.Groups {
+		if len(opts.Groups) > 0 && !slices.Contains(opts.Groups, gi) {
+			continue
+		}
+		v := normalizeVendor(g.Vendor)
+		driver, _ := lookupVendor(v)
+		groupPassword := g.GetPassword()
+		groupName := g.DisplayName()
+
+		for _, a := range g.Assets {
+			if len(opts.Assets) > 0 && !slices.Contains(opts.Assets, a.Name) {
+				continue
+			}
+			totalAssets++
+
+			// Verificar se o asset está ativo
+			if !a.IsActive() {
+				inactiveAssets++
+				c.logger.Info("asset inativo, ignorando",
+					"asset", a.Name,
+					"address", a.Address,
+				)
+				report.Add(JobResult{Asset: a.Name, Address: a.Address, Vendor: v, Status: statusInactive})
+				continue
+			}
+
+			activeAssets++
+
+			// Determinar credenciais (asset override ou group)
+			username := a.Username
+			if username == "" {
+				username = g.Username
+			}
+
+			password := a.GetPassword()
+			if password == "" {
+				password = groupPassword
+			}
+
+			auth := resolveSSHAuth(g, a)
+
+			// Determinar protocolo
+			protocol := strings.ToLower(strings.TrimSpace(a.Protocol))
+			if protocol == "" {
+				protocol = "ssh" // default
+			}
+
+			if password == "" && (protocol == "telnet" || !auth.HasNonPassword()) {
+				c.logger.Error("senha não configurada",
+					"asset", a.Name,
+					"vendor", v,
+					"username", username,
+				)
+				report.Add(JobResult{
+					Asset:      a.Name,
+					Address:    a.Address,
+					Vendor:     v,
+					Protocol:   protocol,
+					Status:     statusSkipped,
+					ErrorClass: "config",
+					Error:      "senha não configurada",
+				})
+				continue
+			}
+
+			// Não sobrepor coletas do mesmo asset (agendamentos próximos)
+			key := v + "__" + assetKey(a.Name, a.Address)
+			if !c.acquire(key) {
+				busyAssets++
+				c.logger.Warn("coleta anterior do asset ainda em andamento, ignorando",
+					"asset", a.Name,
+					"address", a.Address,
+				)
+				report.Add(JobResult{
+					Asset:      a.Name,
+					Address:    a.Address,
+					Vendor:     v,
+					Protocol:   protocol,
+					Status:     statusSkipped,
+					ErrorClass: "overlap",
+					Error:      "coleta anterior em andamento",
+				})
+				continue
+			}
+
+			// Determinar porta
+			port := a.Port
+			if port == 0 {
+				if protocol == "telnet" {
+					port = 23
+				} else {
+					port = 22
+				}
+			}
+
+			// Determinar comandos (asset override, group override ou vendor)
+			commands := resolveCommands(driver, g, a)
+
+			// Determinar prompts (asset override, group override ou vendor)
+			prompts := driver.Prompts()
+			if len(g.PromptPatterns) > 0 {
+				prompts = g.PromptPatterns
+			}
+			if len(a.PromptPatterns) > 0 {
+				prompts = a.PromptPatterns
+			}
+
+			legacy := cfg.resolveSSHLegacy(g, a)
+			if protocol == "ssh" && legacy != nil && legacy.Enabled {
+				legacyAssets++
+			}
+
+			// Criar asset com configurações resolvidas
+			resolvedAsset := a
+			resolvedAsset.Port = port
+
+			done.Add(1)
+			c.jobs <- queuedJob{key: key, st: st, report: report, done: done, job: Job{
+				Vendor:    v,
+				Driver:    driver,
+				Commands:  commands,
+				Prompts:   prompts,
+				Username:  username,
+				Password:  password,
+				Auth:      auth,
+				Asset:     resolvedAsset,
+				Protocol:  protocol,
+				Timeout:   timeout,
+				BaseDir:   outDir,
+				Output:    cfg.Output,
+				Filename:  st.filename,
+				RunID:     report.RunID,
+				Group:     groupName,
+				Logger:    c.logger,
+				SSHLegacy: legacy,
+
+				LegacyFallback: cfg.LegacyFallback == nil || *cfg.LegacyFallback,
+				IgnorePatterns: resolveIgnorePatterns(driver, g, a),
+				ArchiveDir:     cfg.BaseDir,
+				ConfigDiff:     (cfg.ConfigDiff == nil || *cfg.ConfigDiff) && !archiveOnly,
+				GitArchive:     archivePath,
+				ArchiveOnly:    archiveOnly,
+			}}
+		}
+	}
+
+	c.logger.Info("jobs enfileirados",
+		"run_id", report.RunID,
+		"total_assets", totalAssets,
+		"active", activeAssets,
+		"inactive", inactiveAssets,
+		"busy", busyAssets,
+		"ssh_legacy", legacyAssets,
+	)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algoritmos aceitos em output.compression.
+const (
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// Encoder e decoder zstd compartilhados: EncodeAll/DecodeAll são seguros
+// para uso concorrente pelos workers.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func validateCompression(c string) error {
+	switch strings.ToLower(strings.TrimSpace(c)) {
+	case "", compressionGzip, compressionZstd:
+		return nil
+	}
+	return fmt.Errorf("output.compression inválido %q (use %s ou %s)", c, compressionGzip, compressionZstd)
+}
+
+// compressionExt é o sufixo acrescentado ao nome do arquivo (".txt.gz").
+func compressionExt(c string) string {
+	switch c {
+	case compressionGzip:
+		return ".gz"
+	case compressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// compress comprime data com o algoritmo de output.compression ("" não
+// comprime).
+func compress(c string, data []byte) ([]byte, error) {
+	switch c {
+	case compressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case compressionZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+// writeCompressed grava uma coleta com writeAtomic, comprimida conforme c.
+// O chamador escolhe o nome, já com compressionExt(c).
+func writeCompressed(path string, data []byte, perm os.FileMode, c string) error {
+	data, err := compress(c, data)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, data, perm)
+}
+
+// readCaptureFile lê um arquivo de coleta, descomprimindo .gz e .zst.
+func readCaptureFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case strings.HasSuffix(path, ".zst"):
+		out, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return out, nil
+	}
+	return data, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// cmdHeaderRe casa os separadores "==== CMD: <comando> ====" da captura.
+var cmdHeaderRe = regexp.MustCompile(`(?m)^==== CMD: (.*) ====\r?$`)
+
+// extractCommandOutput retorna a saída de cmd dentro de uma captura
+// combinada, do separador do comando até o próximo separador.
+func extractCommandOutput(capture, cmd string) (string, bool) {
+	key := commandKey(cmd)
+	headers := cmdHeaderRe.FindAllStringSubmatchIndex(capture, -1)
+	for i, h := range headers {
+		if commandKey(capture[h[2]:h[3]]) != key {
+			continue
+		}
+		end := len(capture)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		return strings.Trim(capture[h[1]:end], "\n"), true
+	}
+	return "", false
+}
+
+// configLines quebra a seção de configuração em linhas, sem "\r".
+func configLines(section string) []string {
+	section = strings.ReplaceAll(section, "\r", "")
+	if section == "" {
+		return nil
+	}
+	return strings.Split(section, "\n")
+}
+
+// readCaptureCommand lê a saída de cmd de uma captura, seja o arquivo
+// combinado (.txt, .txt.gz, .txt.zst) ou o diretório do modo split.
+func readCaptureCommand(path, cmd string) (string, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false, err
+	}
+	if info.IsDir() {
+		return readSplitCommand(path, cmd)
+	}
+	data, err := readCaptureFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	if isJSONCapture(path) {
+		return jsonCommandOutput(path, data, cmd)
+	}
+	out, ok := extractCommandOutput(string(data), cmd)
+	return out, ok, nil
+}
+
+// findPreviousCapture procura, do dia mais recente para o mais antigo, a
+// última coleta do asset em baseDir que não seja a coleta atual e que seja
+// aceita por accept (nil aceita qualquer coleta). As coletas recusadas são
+// puladas e a busca continua nas mais antigas.
+func findPreviousCapture(baseDir string, current []string, asset string, accept func(dayCapture) bool) (string, error) {
+	days, err := listDayDirs(baseDir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, day := range days {
+		captures, _, err := dayCaptures(filepath.Join(baseDir, day))
+		if err != nil {
+			return "", err
+		}
+		slices.SortStableFunc(captures, func(a, b dayCapture) int { return b.time.Compare(a.time) })
+		for _, c := range captures {
+			if c.asset != asset || slices.Contains(current, c.path) {
+				continue
+			}
+			if _, err := os.Stat(c.path); err != nil {
+				continue
+			}
+			if accept == nil || accept(c) {
+				return c.path, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// diffWithPrevious compara a configuração capturada nesta coleta com a da
+// última coleta bem-sucedida do mesmo asset. Se houver mudança, grava o
+// diff unificado ao lado da captura (.diff) e marca res.ConfigChanged.
+// Linhas voláteis são ignoradas na comparação. Coletas cujo comando de
+// configuração foi truncado, falhou ou não existe não entram na comparação.
+func diffWithPrevious(baseDir string, driver VendorDriver, ignore *lineFilter, out *capture, res *JobResult) error {
+	cmd := driver.ConfigCommand()
+	path := capturePath(res)
+	if cmd == "" || path == "" {
+		return nil
+	}
+	if cfgOut := out.configCommand(driver); cfgOut == nil || !cfgOut.complete() {
+		return nil
+	}
+
+	section, ok, err := readCaptureCommand(path, cmd)
+	if err != nil || !ok {
+		return err
+	}
+
+	var prevSection string
+	current := []string{res.OutputFile, res.JSONFile, res.SplitDir}
+	prevPath, err := findPreviousCapture(baseDir, current, assetKey(res.Asset, res.Address), func(c dayCapture) bool {
+		if c.commandFailed(cmd) {
+			return false
+		}
+		s, ok, err := readCaptureCommand(c.path, cmd)
+		if err != nil || !ok {
+			return false
+		}
+		prevSection = s
+		return true
+	})
+	if err != nil || prevPath == "" {
+		return err
+	}
+
+	res.PreviousFile = prevPath
+	diff := unifiedDiff(prevPath, path, ignore.Filter(configLines(prevSection)), ignore.Filter(configLines(section)), 3)
+	changed := diff != ""
+	res.ConfigChanged = &changed
+	if !changed {
+		return nil
+	}
+
+	diffPath := filepath.Join(filepath.Dir(path), captureBase(filepath.Base(path))+".diff")
+	if err := writeAtomic(diffPath, []byte(diff), 0o644); err != nil {
+		return fmt.Errorf("gravando diff: %w", err)
+	}
+	res.DiffFile = diffPath
+	return nil
+}
+
+// compareWithPrevious executa diffWithPrevious para um job concluído e
+// registra o resultado no log. Erros não invalidam a coleta.
+func compareWithPrevious(job Job, ignore *lineFilter, out *capture, res *JobResult) {
+	if cfgOut := out.configCommand(job.Driver); job.Driver.ConfigCommand() != "" && (cfgOut == nil || !cfgOut.complete()) {
+		job.Logger.Warn("configuração incompleta, comparação com coleta anterior ignorada", "asset", job.Asset.Name)
+		return
+	}
+	if err := diffWithPrevious(job.ArchiveDir, job.Driver, ignore, out, res); err != nil {
+		job.Logger.Warn("erro comparando com coleta anterior", "asset", job.Asset.Name, "error", err)
+		return
+	}
+	switch {
+	case res.ConfigChanged == nil:
+		job.Logger.Info("sem coleta anterior para comparar", "asset", job.Asset.Name)
+	case *res.ConfigChanged:
+		job.Logger.Info("configuração alterada", "asset", job.Asset.Name, "previous", res.PreviousFile, "diff", res.DiffFile)
+	default:
+		job.Logger.Info("configuração inalterada", "asset", job.Asset.Name, "previous", res.PreviousFile)
+	}
+}
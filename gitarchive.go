@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// GitArchiveConfig aponta para um repositório git local onde a configuração
+// normalizada de cada asset é gravada em um caminho estável
+// (<vendor>/<asset>__<address>.txt), com um commit por execução.
+type GitArchiveConfig struct {
+	Path        string `json:"path"`
+	AuthorName  string `json:"author_name,omitempty"`  // default: "config-collector"
+	AuthorEmail string `json:"author_email,omitempty"` // default: "config-collector@localhost"
+	Exclusive   bool   `json:"exclusive,omitempty"`    // Não grava as coletas com timestamp em base_dir
+}
+
+func (g *GitArchiveConfig) Validate() error {
+	if g == nil {
+		return nil
+	}
+	if strings.TrimSpace(g.Path) == "" {
+		return errors.New("git_archive.path não pode ser vazio")
+	}
+	return nil
+}
+
+// openGitArchive abre o repositório em path, inicializando-o se ainda não
+// existir. A implementação é em Go puro, sem depender do binário git.
+func openGitArchive(path string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(path)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return nil, err
+		}
+		return git.PlainInit(path, false)
+	}
+	return repo, err
+}
+
+// archivePath é o caminho do asset dentro do repositório (separador "/").
+// O nome inclui o endereço, como nas coletas, para que assets homônimos de
+// grupos ou sites diferentes não sobrescrevam o arquivo um do outro.
+func archivePath(vendor, name, address string) string {
+	return path.Join(sanitize(vendor), assetKey(name, address)+".txt")
+}
+
+// archiveConfig grava a configuração do asset no repositório, já sem as
+// linhas voláteis, para que coletas de um equipamento inalterado não gerem
+// mudança. Não faz nada se o comando de configuração não foi coletado; se
+// ele não terminou (timeout, erro), a saída parcial não é arquivada, para
+// não registrar uma remoção falsa de configuração.
+func archiveConfig(job Job, c *capture, ignore *lineFilter, res *JobResult) error {
+	cmd := c.configCommand(job.Driver)
+	if cmd == nil {
+		return nil
+	}
+	if !cmd.complete() {
+		job.Logger.Warn("configuração incompleta, não arquivada no git_archive",
+			"asset", job.Asset.Name,
+			"cmd", cmd.Command,
+			"truncated", cmd.Truncated,
+			"error", cmd.Error,
+		)
+		return nil
+	}
+	lines := ignore.Filter(configLines(strings.Trim(cmd.Output, "\n")))
+	data := []byte(strings.Join(lines, "\n") + "\n")
+
+	rel := archivePath(job.Vendor, job.Asset.Name, job.Asset.Address)
+	full := filepath.Join(job.GitArchive, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	if err := writeAtomic(full, data, 0o644); err != nil {
+		return err
+	}
+	res.ArchiveFile = rel
+	if job.ArchiveOnly {
+		res.Bytes = len(data)
+	}
+	return nil
+}
+
+// commitGitArchive adiciona ao índice apenas os arquivos de assets desta
+// execução que mudaram e faz um commit listando os equipamentos alterados.
+// Retorna o hash do commit ("" se nada mudou) e os assets alterados.
+func commitGitArchive(repo *git.Repository, cfg *GitArchiveConfig, results []JobResult, when time.Time) (string, []string, error) {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", nil, err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return "", nil, fmt.Errorf("git status: %w", err)
+	}
+
+	var changed []string
+	for _, res := range results {
+		if res.ArchiveFile == "" {
+			continue
+		}
+		st, ok := status[res.ArchiveFile]
+		if !ok || (st.Worktree == git.Unmodified && st.Staging == git.Unmodified) {
+			continue
+		}
+		if _, err := wt.Add(res.ArchiveFile); err != nil {
+			return "", nil, fmt.Errorf("git add %s: %w", res.ArchiveFile, err)
+		}
+		changed = append(changed, res.Asset)
+	}
+	if len(changed) == 0 {
+		return "", nil, nil
+	}
+	sort.Strings(changed)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "Coleta %s: %d equipamento(s) alterado(s)\n\n", when.Format("2006-01-02 15:04:05"), len(changed))
+	for _, name := range changed {
+		fmt.Fprintf(&msg, "- %s\n", name)
+	}
+
+	name, email := cfg.AuthorName, cfg.AuthorEmail
+	if name == "" {
+		name = "config-collector"
+	}
+	if email == "" {
+		email = "config-collector@localhost"
+	}
+	hash, err := wt.Commit(msg.String(), &git.CommitOptions{
+		Author: &object.Signature{Name: name, Email: email, When: when},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("git commit: %w", err)
+	}
+	return hash.String(), changed, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Políticas aceitas em host_key_policy.
+const (
+	hostKeyStrict   = "strict"
+	hostKeyTOFU     = "tofu"
+	hostKeyInsecure = "insecure"
+)
+
+// ErrHostKeyMismatch indica que a chave apresentada pelo equipamento difere da
+// registrada no known_hosts. Não é retentado: pode ser um ataque MITM.
+var ErrHostKeyMismatch = errors.New("chave de host divergente do known_hosts")
+
+type hostKeyMismatchError struct {
+	Host        string
+	Fingerprint string
+}
+
+func (e *hostKeyMismatchError) Error() string {
+	return fmt.Sprintf("%s: host=%s fingerprint=%s", ErrHostKeyMismatch, e.Host, e.Fingerprint)
+}
+
+func (e *hostKeyMismatchError) Unwrap() error {
+	return ErrHostKeyMismatch
+}
+
+// hostKeyTypeError indica que o host está no known_hosts apenas com chaves
+// de outro tipo (ex.: ecdsa registrada, servidor oferece ed25519). Não é
+// divergência: a conexão é refeita restringindo os algoritmos de chave de
+// host aos tipos conhecidos.
+type hostKeyTypeError struct {
+	Host    string
+	Offered string
+	Known   []string
+}
+
+func (e *hostKeyTypeError) Error() string {
+	return fmt.Sprintf("host %s conhecido no known_hosts com chaves %s, servidor ofereceu %s",
+		e.Host, strings.Join(e.Known, ", "), e.Offered)
+}
+
+// algorithms retorna os algoritmos de assinatura aceitos para as chaves
+// conhecidas, mantendo a ordem de preferência de current (ou do pacote ssh,
+// se vazio).
+func (e *hostKeyTypeError) algorithms(current []string) []string {
+	accepted := make(map[string]bool)
+	for _, t := range e.Known {
+		accepted[t] = true
+		if t == ssh.KeyAlgoRSA {
+			accepted[ssh.KeyAlgoRSASHA512] = true
+			accepted[ssh.KeyAlgoRSASHA256] = true
+		}
+	}
+	if len(current) == 0 {
+		current = ssh.SupportedAlgorithms().HostKeys
+	}
+	var algos []string
+	for _, a := range current {
+		if accepted[a] {
+			algos = append(algos, a)
+		}
+	}
+	return algos
+}
+
+// hostKeyStore valida chaves contra o known_hosts. No modo tofu, chaves de
+// hosts desconhecidos são gravadas no arquivo; o mutex é compartilhado por
+// todos os workers para que as escritas não se misturem.
+type hostKeyStore struct {
+	mu     sync.Mutex
+	path   string
+	policy string
+	check  ssh.HostKeyCallback
+	logger *slog.Logger
+}
+
+// hostKeyStores guarda um hostKeyStore por known_hosts, reaproveitado nos
+// reloads: execuções com a configuração anterior e as novas gravam no mesmo
+// arquivo sob o mesmo mutex.
+var (
+	hostKeyStoresMu sync.Mutex
+	hostKeyStores   = make(map[string]*hostKeyStore)
+)
+
+// sharedHostKeyStore retorna o store de path, criando-o na primeira vez.
+// Um store existente passa a usar policy e relê o arquivo.
+func sharedHostKeyStore(path, policy string, logger *slog.Logger) (*hostKeyStore, error) {
+	key := filepath.Clean(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		key = abs
+	}
+
+	hostKeyStoresMu.Lock()
+	defer hostKeyStoresMu.Unlock()
+
+	if s, ok := hostKeyStores[key]; ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.policy = policy
+		if err := s.reload(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	s, err := newHostKeyStore(path, policy, logger)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyStores[key] = s
+	return s, nil
+}
+
+func newHostKeyStore(path, policy string, logger *slog.Logger) (*hostKeyStore, error) {
+	s := &hostKeyStore{path: path, policy: policy, logger: logger}
+
+	if policy == hostKeyTOFU {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, fmt.Errorf("criando diretório do known_hosts: %w", err)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("criando known_hosts: %w", err)
+		}
+		f.Close()
+	}
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *hostKeyStore) reload() error {
+	check, err := knownhosts.New(s.path)
+	if err != nil {
+		return fmt.Errorf("carregando known_hosts %s: %w", s.path, err)
+	}
+	s.check = check
+	return nil
+}
+
+func (s *hostKeyStore) Callback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.check(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	if len(keyErr.Want) > 0 {
+		// O knownhosts também preenche Want quando o host só é conhecido
+		// com outro tipo de chave; divergência é só no mesmo tipo
+		var known []string
+		for _, w := range keyErr.Want {
+			if w.Key.Type() == key.Type() {
+				return &hostKeyMismatchError{Host: hostname, Fingerprint: fingerprint}
+			}
+			known = append(known, w.Key.Type())
+		}
+		sort.Strings(known)
+		return &hostKeyTypeError{Host: hostname, Offered: key.Type(), Known: known}
+	}
+
+	if s.policy != hostKeyTOFU {
+		return fmt.Errorf("host %s desconhecido no known_hosts (fingerprint %s)", hostname, fingerprint)
+	}
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("gravando known_hosts: %w", err)
+	}
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		f.Close()
+		return fmt.Errorf("gravando known_hosts: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("gravando known_hosts: %w", err)
+	}
+
+	s.logger.Warn("tofu: nova chave de host registrada",
+		"host", hostname,
+		"key_type", key.Type(),
+		"fingerprint", fingerprint,
+		"path", s.path,
+	)
+	return s.reload()
+}
+
+func validateHostKeyPolicy(policy, knownHostsPath string) error {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", hostKeyInsecure:
+		return nil
+	case hostKeyStrict, hostKeyTOFU:
+		if knownHostsPath == "" {
+			return fmt.Errorf("host_key_policy %q exige known_hosts_file", policy)
+		}
+		return nil
+	default:
+		return fmt.Errorf("host_key_policy inválida %q (use strict, tofu ou insecure)", policy)
+	}
+}
@@ -0,0 +1,687 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InventorySource importa assets de um inventário externo para os grupos
+// do arquivo de targets. Cada asset vai para o grupo indicado (group da
+// regra de tag ou da fonte) ou para o primeiro grupo do seu vendor, de onde
+// herda credenciais e comandos. No modo serve, mudanças nos arquivos de
+// inventário são aplicadas no SIGHUP ou quando o arquivo de targets muda.
+type InventorySource struct {
+	Format       string                   `json:"format"`                  // "csv" | "netbox" | "ansible"
+	Path         string                   `json:"path"`                    // Relativo ao arquivo de targets
+	Group        string                   `json:"group,omitempty"`         // Grupo de destino padrão (name)
+	Platforms    map[string]string        `json:"platforms,omitempty"`     // platform -> vendor (somados aos conhecidos)
+	Tags         map[string]InventoryRule `json:"tags,omitempty"`          // tag -> atributos aplicados ao asset
+	SkipUnmapped bool                     `json:"skip_unmapped,omitempty"` // Ignora assets sem vendor, sem endereço ou inativos em vez de falhar
+}
+
+// InventoryRule são os atributos aplicados aos assets que têm uma tag
+// (no Ansible, os grupos do host).
+type InventoryRule struct {
+	Group          string `json:"group,omitempty"`
+	Vendor         string `json:"vendor,omitempty"`
+	Protocol       string `json:"protocol,omitempty"`
+	Port           int    `json:"port,omitempty"`
+	Username       string `json:"username,omitempty"`
+	PasswordEnv    string `json:"password_env,omitempty"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	CryptoProfile  string `json:"crypto_profile,omitempty"`
+	Active         *bool  `json:"active,omitempty"`
+}
+
+// inventoryAsset é um equipamento lido do inventário, antes do mapeamento.
+type inventoryAsset struct {
+	Name     string
+	Address  string
+	Port     int
+	Platform string
+	Vendor   string
+	Protocol string
+	Group    string
+	Username string
+	Tags     []string
+	Active   *bool
+}
+
+// InventoryLoader lê os equipamentos de um formato de inventário.
+type InventoryLoader interface {
+	Load(r io.Reader) ([]inventoryAsset, error)
+}
+
+func inventoryLoader(format, path string) (InventoryLoader, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return csvInventory{}, nil
+	case "netbox":
+		return netboxInventory{}, nil
+	case "ansible":
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == ".yml" || ext == ".yaml" {
+			return ansibleYAMLInventory{}, nil
+		}
+		return ansibleINIInventory{}, nil
+	}
+	return nil, fmt.Errorf("format inválido %q (use csv, netbox ou ansible)", format)
+}
+
+// knownPlatforms mapeia nomes comuns de plataforma (slugs do NetBox,
+// ansible_network_os) para os vendors suportados.
+var knownPlatforms = map[string]string{
+	"vrp":                         "huawei",
+	"huawei-vrp":                  "huawei",
+	"community.network.ce":        "huawei",
+	"ce":                          "huawei",
+	"zxros":                       "zte",
+	"ios":                         "cisco_ios",
+	"ios-xe":                      "cisco_ios",
+	"cisco-ios":                   "cisco_ios",
+	"cisco-ios-xe":                "cisco_ios",
+	"cisco.ios.ios":               "cisco_ios",
+	"eos":                         "arista_eos",
+	"arista-eos":                  "arista_eos",
+	"arista.eos.eos":              "arista_eos",
+	"juniper-junos":               "junos",
+	"junipernetworks.junos.junos": "junos",
+}
+
+// resolveVendor procura o vendor explícito e depois a plataforma em
+// platforms da fonte, nas plataformas conhecidas e nos vendors registrados.
+func (s *InventorySource) resolveVendor(a inventoryAsset) string {
+	for _, name := range []string{a.Vendor, a.Platform} {
+		name = normalizeVendor(name)
+		if name == "" {
+			continue
+		}
+		if v, ok := s.Platforms[name]; ok {
+			return normalizeVendor(v)
+		}
+		if v, ok := knownPlatforms[name]; ok {
+			return v
+		}
+		if _, ok := lookupVendor(name); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// expandInventory lê as fontes de cfg.Inventory e acrescenta os assets aos
+// grupos. baseDir é o diretório do arquivo de targets.
+func (c *Config) expandInventory(baseDir string) error {
+	for i, src := range c.Inventory {
+		if err := c.importInventory(src, baseDir); err != nil {
+			return fmt.Errorf("inventory[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) importInventory(src InventorySource, baseDir string) error {
+	if strings.TrimSpace(src.Path) == "" {
+		return errors.New("path não pode ser vazio")
+	}
+	loader, err := inventoryLoader(src.Format, src.Path)
+	if err != nil {
+		return err
+	}
+	path := src.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	assets, err := loader.Load(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Um asset repetido seria coletado duas vezes na mesma execução
+	seen := make(map[string]string)
+	for gi, g := range c.Groups {
+		for _, a := range g.Assets {
+			seen[assetKey(a.Name, a.Address)] = fmt.Sprintf("grupo[%d]", gi)
+		}
+	}
+
+	for _, ia := range assets {
+		if ia.Name == "" || ia.Address == "" {
+			// PDUs, patch panels etc. costumam não ter endereço no NetBox
+			if src.SkipUnmapped {
+				continue
+			}
+			return fmt.Errorf("%s: asset sem nome ou endereço (%q)", path, ia.Name)
+		}
+		a := Asset{
+			Name:     ia.Name,
+			Address:  ia.Address,
+			Port:     ia.Port,
+			Protocol: ia.Protocol,
+			Username: ia.Username,
+			Active:   ia.Active,
+		}
+		group := ia.Group
+		if group == "" {
+			group = src.Group
+		}
+
+		tags := append([]string(nil), ia.Tags...)
+		sort.Strings(tags)
+		for _, tag := range tags {
+			rule, ok := src.Tags[tag]
+			if !ok {
+				continue
+			}
+			if rule.Vendor != "" {
+				ia.Vendor = rule.Vendor
+			}
+			if rule.Group != "" {
+				group = rule.Group
+			}
+			rule.apply(&a)
+		}
+
+		if src.SkipUnmapped && !a.IsActive() {
+			continue
+		}
+
+		vendor := src.resolveVendor(ia)
+		if vendor == "" {
+			if src.SkipUnmapped {
+				continue
+			}
+			return fmt.Errorf("%s: asset %s: plataforma %q sem vendor (configure platforms ou tags)", path, ia.Name, ia.Platform)
+		}
+
+		key := assetKey(a.Name, a.Address)
+		if where, dup := seen[key]; dup {
+			return fmt.Errorf("%s: asset %s (%s) já definido em %s", path, a.Name, a.Address, where)
+		}
+
+		g := c.inventoryGroup(group, vendor)
+		if g == nil {
+			if group != "" {
+				return fmt.Errorf("%s: asset %s: grupo %q com vendor %s não encontrado", path, ia.Name, group, vendor)
+			}
+			return fmt.Errorf("%s: asset %s: nenhum grupo para o vendor %s", path, ia.Name, vendor)
+		}
+		g.Assets = append(g.Assets, a)
+		seen[key] = path
+	}
+	return nil
+}
+
+// runConvert grava o arquivo de targets com os assets do inventário já
+// expandidos em groups[].assets[] e sem a seção inventory.
+func runConvert(args []string, logger *slog.Logger) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	outPath := fs.String("o", "", "arquivo de saída (default: stdout)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: collector convert [-o arquivo] <targets.json>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(fs.Arg(0))
+	if err != nil {
+		logger.Error("erro lendo config", "error", err)
+		return exitConfig
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Error("config inválida", "error", err)
+		return exitConfig
+	}
+	cfg.Inventory = nil
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		logger.Error("erro gerando targets", "error", err)
+		return exitConfig
+	}
+	data = append(data, '\n')
+	if *outPath == "" {
+		_, _ = os.Stdout.Write(data)
+		return exitOK
+	}
+	if err := writeAtomic(*outPath, data, 0o600); err != nil {
+		logger.Error("erro gravando targets", "path", *outPath, "error", err)
+		return exitConfig
+	}
+	assets := 0
+	for _, g := range cfg.Groups {
+		assets += len(g.Assets)
+	}
+	logger.Info("targets gerado", "path", *outPath, "groups", len(cfg.Groups), "assets", assets)
+	return exitOK
+}
+
+func (r InventoryRule) apply(a *Asset) {
+	if r.Protocol != "" {
+		a.Protocol = r.Protocol
+	}
+	if r.Port != 0 {
+		a.Port = r.Port
+	}
+	if r.Username != "" {
+		a.Username = r.Username
+	}
+	if r.PasswordEnv != "" {
+		a.PasswordEnv = r.PasswordEnv
+	}
+	if r.PrivateKeyFile != "" {
+		a.PrivateKeyFile = r.PrivateKeyFile
+	}
+	if r.CryptoProfile != "" {
+		a.CryptoProfile = r.CryptoProfile
+	}
+	if r.Active != nil {
+		a.Active = r.Active
+	}
+}
+
+// inventoryGroup retorna o grupo de destino: pelo nome, se informado, ou o
+// primeiro grupo do vendor.
+func (c *Config) inventoryGroup(name, vendor string) *Group {
+	for i := range c.Groups {
+		g := &c.Groups[i]
+		if normalizeVendor(g.Vendor) != vendor {
+			continue
+		}
+		if name == "" || g.DisplayName() == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// csvInventory lê um CSV com cabeçalho. Colunas reconhecidas: name,
+// address (ou host, ip), port, platform, vendor, protocol, group, username,
+// tags (separadas por ";") e active. As demais são ignoradas.
+type csvInventory struct{}
+
+func (csvInventory) Load(r io.Reader) ([]inventoryAsset, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("lendo cabeçalho: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	field := func(rec []string, names ...string) string {
+		for _, n := range names {
+			if i, ok := cols[n]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+		}
+		return ""
+	}
+
+	var assets []inventoryAsset
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		a := inventoryAsset{
+			Name:     field(rec, "name"),
+			Address:  field(rec, "address", "host", "ip"),
+			Platform: field(rec, "platform"),
+			Vendor:   field(rec, "vendor"),
+			Protocol: field(rec, "protocol"),
+			Group:    field(rec, "group"),
+			Username: field(rec, "username"),
+		}
+		if p := field(rec, "port"); p != "" {
+			if a.Port, err = strconv.Atoi(p); err != nil {
+				return nil, fmt.Errorf("linha %d: port inválida %q", line, p)
+			}
+		}
+		if t := field(rec, "tags"); t != "" {
+			for _, tag := range strings.Split(t, ";") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					a.Tags = append(a.Tags, tag)
+				}
+			}
+		}
+		if v := field(rec, "active"); v != "" {
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("linha %d: active inválido %q", line, v)
+			}
+			a.Active = &active
+		}
+		assets = append(assets, a)
+	}
+	return assets, nil
+}
+
+// netboxInventory lê a exportação JSON da lista de devices do NetBox (a
+// resposta de /api/dcim/devices/, com "results", ou só a lista). O endereço
+// é o primary_ip, a plataforma o slug de platform e as tags os slugs das
+// tags; devices com status diferente de active ficam inativos.
+type netboxInventory struct{}
+
+type netboxRef struct {
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type netboxIP struct {
+	Address string `json:"address"`
+}
+
+type netboxDevice struct {
+	Name       string      `json:"name"`
+	PrimaryIP  *netboxIP   `json:"primary_ip"`
+	PrimaryIP4 *netboxIP   `json:"primary_ip4"`
+	PrimaryIP6 *netboxIP   `json:"primary_ip6"`
+	Platform   *netboxRef  `json:"platform"`
+	Status     *netboxRef  `json:"status"`
+	Tags       []netboxRef `json:"tags"`
+}
+
+func (netboxInventory) Load(r io.Reader) ([]inventoryAsset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var devices []netboxDevice
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &devices)
+	} else {
+		var page struct {
+			Results []netboxDevice `json:"results"`
+		}
+		err = json.Unmarshal(data, &page)
+		devices = page.Results
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	assets := make([]inventoryAsset, 0, len(devices))
+	for _, d := range devices {
+		a := inventoryAsset{Name: d.Name}
+		for _, ip := range []*netboxIP{d.PrimaryIP, d.PrimaryIP4, d.PrimaryIP6} {
+			if ip != nil && ip.Address != "" {
+				a.Address, _, _ = strings.Cut(ip.Address, "/")
+				break
+			}
+		}
+		if d.Platform != nil {
+			a.Platform = d.Platform.Slug
+			if a.Platform == "" {
+				a.Platform = d.Platform.Name
+			}
+		}
+		for _, t := range d.Tags {
+			if t.Slug != "" {
+				a.Tags = append(a.Tags, t.Slug)
+			} else {
+				a.Tags = append(a.Tags, t.Name)
+			}
+		}
+		if d.Status != nil && d.Status.Value != "" {
+			active := d.Status.Value == "active"
+			a.Active = &active
+		}
+		assets = append(assets, a)
+	}
+	return assets, nil
+}
+
+// ansibleGroup é um grupo do inventário Ansible, em INI ou YAML.
+type ansibleGroup struct {
+	Hosts    map[string]map[string]any `yaml:"hosts"`
+	Vars     map[string]any            `yaml:"vars"`
+	Children map[string]*ansibleGroup  `yaml:"children"`
+}
+
+// ansibleHosts percorre a árvore de grupos a partir de all e monta os
+// assets. Como no Ansible, grupos de primeiro nível (inclusive ungrouped)
+// são filhos de all, as vars dos grupos são aplicadas por profundidade (o
+// filho prevalece sobre o pai; no mesmo nível, vale a ordem alfabética) e
+// as do host prevalecem sobre as dos grupos. Os grupos do host viram tags.
+// Variáveis usadas: ansible_host, ansible_port, ansible_user,
+// ansible_network_os e ansible_connection ("telnet" define o protocolo).
+func ansibleHosts(root map[string]*ansibleGroup) []inventoryAsset {
+	all := root["all"]
+	if all == nil {
+		all = &ansibleGroup{}
+	}
+	children := make(map[string]*ansibleGroup, len(all.Children)+len(root))
+	for name, g := range all.Children {
+		children[name] = g
+	}
+	for name, g := range root {
+		if name != "all" {
+			children[name] = g
+		}
+	}
+	all = &ansibleGroup{Hosts: all.Hosts, Vars: all.Vars, Children: children}
+
+	type hostInfo struct {
+		vars   map[string]any
+		groups map[string]bool
+	}
+	hosts := make(map[string]*hostInfo)
+	groupVars := make(map[string]map[string]any)
+	groupDepth := make(map[string]int)
+	var order []string
+
+	var walk func(name string, g *ansibleGroup, depth int, path []string, seen map[string]bool)
+	walk = func(name string, g *ansibleGroup, depth int, path []string, seen map[string]bool) {
+		if g == nil || seen[name] {
+			return
+		}
+		seen[name] = true
+		defer delete(seen, name)
+
+		// Um grupo alcançado por mais de um caminho fica na maior
+		// profundidade
+		if d, ok := groupDepth[name]; !ok || depth > d {
+			groupDepth[name] = depth
+		}
+		groupVars[name] = g.Vars
+		path = append(path, name)
+
+		hostNames := make([]string, 0, len(g.Hosts))
+		for h := range g.Hosts {
+			hostNames = append(hostNames, h)
+		}
+		sort.Strings(hostNames)
+		for _, h := range hostNames {
+			info, ok := hosts[h]
+			if !ok {
+				info = &hostInfo{vars: make(map[string]any), groups: make(map[string]bool)}
+				hosts[h] = info
+				order = append(order, h)
+			}
+			for k, v := range g.Hosts[h] {
+				info.vars[k] = v
+			}
+			for _, p := range path {
+				info.groups[p] = true
+			}
+		}
+
+		childNames := make([]string, 0, len(g.Children))
+		for c := range g.Children {
+			childNames = append(childNames, c)
+		}
+		sort.Strings(childNames)
+		for _, c := range childNames {
+			walk(c, g.Children[c], depth+1, path, seen)
+		}
+	}
+	walk("all", all, 0, nil, make(map[string]bool))
+
+	assets := make([]inventoryAsset, 0, len(order))
+	for _, h := range order {
+		info := hosts[h]
+
+		groups := make([]string, 0, len(info.groups))
+		for g := range info.groups {
+			groups = append(groups, g)
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			if groupDepth[groups[i]] != groupDepth[groups[j]] {
+				return groupDepth[groups[i]] < groupDepth[groups[j]]
+			}
+			return groups[i] < groups[j]
+		})
+		vars := make(map[string]any)
+		var tags []string
+		for _, g := range groups {
+			for k, v := range groupVars[g] {
+				vars[k] = v
+			}
+			if g != "all" && g != "ungrouped" {
+				tags = append(tags, g)
+			}
+		}
+		for k, v := range info.vars {
+			vars[k] = v
+		}
+
+		str := func(key string) string {
+			if v, ok := vars[key]; ok && v != nil {
+				return strings.TrimSpace(fmt.Sprint(v))
+			}
+			return ""
+		}
+		a := inventoryAsset{
+			Name:     h,
+			Address:  str("ansible_host"),
+			Platform: str("ansible_network_os"),
+			Username: str("ansible_user"),
+			Tags:     tags,
+		}
+		if a.Address == "" {
+			a.Address = h
+		}
+		if p, err := strconv.Atoi(str("ansible_port")); err == nil {
+			a.Port = p
+		}
+		if str("ansible_connection") == "telnet" {
+			a.Protocol = "telnet"
+		}
+		assets = append(assets, a)
+	}
+	return assets
+}
+
+// ansibleYAMLInventory lê inventários Ansible em YAML.
+type ansibleYAMLInventory struct{}
+
+func (ansibleYAMLInventory) Load(r io.Reader) ([]inventoryAsset, error) {
+	var root map[string]*ansibleGroup
+	if err := yaml.NewDecoder(r).Decode(&root); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return ansibleHosts(root), nil
+}
+
+// ansibleINIInventory lê inventários Ansible em INI: seções [grupo],
+// [grupo:vars] e [grupo:children]; hosts fora de seção vão para ungrouped.
+type ansibleINIInventory struct{}
+
+func (ansibleINIInventory) Load(r io.Reader) ([]inventoryAsset, error) {
+	groups := make(map[string]*ansibleGroup)
+	group := func(name string) *ansibleGroup {
+		g, ok := groups[name]
+		if !ok {
+			g = &ansibleGroup{Hosts: make(map[string]map[string]any), Vars: make(map[string]any), Children: make(map[string]*ansibleGroup)}
+			groups[name] = g
+		}
+		return g
+	}
+	isChild := make(map[string]bool)
+
+	section, kind := "ungrouped", "hosts"
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section, kind = strings.Trim(text, "[]"), "hosts"
+			if name, k, ok := strings.Cut(section, ":"); ok {
+				section, kind = name, k
+			}
+			group(section)
+			continue
+		}
+
+		fields := strings.Fields(text)
+		switch kind {
+		case "hosts":
+			vars := make(map[string]any)
+			for _, kv := range fields[1:] {
+				k, v, ok := strings.Cut(kv, "=")
+				if !ok {
+					return nil, fmt.Errorf("linha %d: variável inválida %q", line, kv)
+				}
+				vars[k] = strings.Trim(v, `"'`)
+			}
+			group(section).Hosts[fields[0]] = vars
+		case "vars":
+			k, v, ok := strings.Cut(text, "=")
+			if !ok {
+				return nil, fmt.Errorf("linha %d: variável inválida %q", line, text)
+			}
+			group(section).Vars[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"'`)
+		case "children":
+			group(section).Children[fields[0]] = group(fields[0])
+			isChild[fields[0]] = true
+		default:
+			return nil, fmt.Errorf("linha %d: seção inválida [%s:%s]", line, section, kind)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	root := make(map[string]*ansibleGroup)
+	for name, g := range groups {
+		if !isChild[name] {
+			root[name] = g
+		}
+	}
+	return ansibleHosts(root), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnsibleVarPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		loader   InventoryLoader
+		inv      string
+		platform string
+		user     string
+	}{
+		{
+			name:   "all:vars no INI",
+			loader: ansibleINIInventory{},
+			inv: `
+[all:vars]
+ansible_network_os=ios
+ansible_user=backup
+
+[switches]
+sw1
+`,
+			platform: "ios",
+			user:     "backup",
+		},
+		{
+			name:   "filho prevalece sobre o pai com o host nos dois grupos",
+			loader: ansibleINIInventory{},
+			inv: `
+[network]
+sw1
+
+[network:vars]
+ansible_network_os=ios
+
+[core]
+sw1
+
+[core:vars]
+ansible_network_os=vrp
+
+[network:children]
+core
+`,
+			platform: "vrp",
+		},
+		{
+			name:   "irmãos no mesmo nível: vale a ordem alfabética",
+			loader: ansibleINIInventory{},
+			inv: `
+[b_site]
+sw1
+
+[b_site:vars]
+ansible_user=b
+
+[a_site]
+sw1
+
+[a_site:vars]
+ansible_user=a
+`,
+			user: "b",
+		},
+		{
+			name:   "vars do host prevalecem",
+			loader: ansibleINIInventory{},
+			inv: `
+[switches]
+sw1 ansible_user=local
+
+[switches:vars]
+ansible_user=group
+`,
+			user: "local",
+		},
+		{
+			name:   "YAML: filho prevalece sobre all",
+			loader: ansibleYAMLInventory{},
+			inv: `
+all:
+  vars:
+    ansible_network_os: ios
+    ansible_user: backup
+  children:
+    huawei:
+      vars:
+        ansible_network_os: vrp
+      hosts:
+        sw1:
+`,
+			platform: "vrp",
+			user:     "backup",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assets, err := tt.loader.Load(strings.NewReader(tt.inv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(assets) != 1 {
+				t.Fatalf("esperado 1 asset, obtido %d", len(assets))
+			}
+			if a := assets[0]; a.Platform != tt.platform || a.Username != tt.user {
+				t.Errorf("platform=%q user=%q, esperado platform=%q user=%q", a.Platform, a.Username, tt.platform, tt.user)
+			}
+		})
+	}
+}
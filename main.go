@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/fs"
@@ -13,24 +14,41 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/ziutek/telnet"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+// version é gravada nas coletas JSON; definida no build com
+// -ldflags "-X main.version=...".
+var version = "dev"
+
 type Config struct {
-	BaseDir        string     `json:"base_dir"`
-	TimeoutSeconds int        `json:"timeout_seconds"`
-	Concurrency    int        `json:"concurrency"`
-	MaxRetries     int        `json:"max_retries"`
-	KnownHostsFile string     `json:"known_hosts_file,omitempty"`
-	SSHLegacy      *SSHLegacy `json:"ssh_legacy,omitempty"`
-	Groups         []Group    `json:"groups"`
+	BaseDir        string            `json:"base_dir"`
+	TimeoutSeconds int               `json:"timeout_seconds"`
+	Concurrency    int               `json:"concurrency"`
+	MaxRetries     int               `json:"max_retries"`
+	KnownHostsFile string            `json:"known_hosts_file,omitempty"`
+	HostKeyPolicy  string            `json:"host_key_policy,omitempty"` // "strict" | "tofu" | "insecure"
+	ReportCSV      bool              `json:"report_csv,omitempty"`      // Também grava run-report.csv
+	SSHLegacy      *SSHLegacy        `json:"ssh_legacy,omitempty"`
+	LegacyFallback *bool             `json:"ssh_legacy_fallback,omitempty"` // default: true
+	ConfigDiff     *bool             `json:"config_diff,omitempty"`         // Compara com a coleta anterior (default: true)
+	Output         OutputConfig      `json:"output,omitempty"`
+	GitArchive     *GitArchiveConfig `json:"git_archive,omitempty"`
+	Retention      *RetentionConfig  `json:"retention,omitempty"` // Aplicada pelo subcomando prune
+	API            *APIConfig        `json:"api,omitempty"`       // API HTTP do modo serve
+	Metrics        *MetricsConfig    `json:"metrics,omitempty"`   // Métricas Prometheus
+	Inventory      []InventorySource `json:"inventory,omitempty"` // Assets importados de CSV, NetBox ou Ansible
+	Groups         []Group           `json:"groups"`
+
+	// Perfis nomeados referenciados por crypto_profile em grupos/assets
+	CryptoProfiles map[string]*SSHLegacy `json:"crypto_profiles,omitempty"`
 }
 
 type SSHLegacy struct {
@@ -42,11 +60,24 @@ type SSHLegacy struct {
 }
 
 type Group struct {
-	Vendor      string  `json:"vendor"` // "huawei" | "zte"
-	Username    string  `json:"username"`
-	Password    string  `json:"password,omitempty"`
-	PasswordEnv string  `json:"password_env,omitempty"`
-	Assets      []Asset `json:"assets"`
+	Name            string     `json:"name,omitempty"`     // Campo Group do filename_template (default: vendor)
+	Vendor          string     `json:"vendor"`             // ver vendorNames()
+	Schedule        string     `json:"schedule,omitempty"` // Expressão cron do modo serve ("0 * * * *", "@daily")
+	Username        string     `json:"username"`
+	Password        string     `json:"password,omitempty"`
+	PasswordEnv     string     `json:"password_env,omitempty"`
+	PrivateKeyFile  string     `json:"private_key_file,omitempty"`
+	PassphraseEnv   string     `json:"private_key_passphrase_env,omitempty"`
+	UseSSHAgent     *bool      `json:"use_ssh_agent,omitempty"`
+	AuthMethods     []string   `json:"auth_methods,omitempty"`     // Ordem: publickey, agent, keyboard-interactive, password
+	SSHLegacy       *SSHLegacy `json:"ssh_legacy,omitempty"`       // Substitui o ssh_legacy global
+	CryptoProfile   string     `json:"crypto_profile,omitempty"`   // Nome em crypto_profiles
+	Commands        []string   `json:"commands,omitempty"`         // Substitui os comandos do vendor
+	ExtraCommands   []string   `json:"extra_commands,omitempty"`   // Adicionados aos comandos do vendor
+	ExcludeCommands []string   `json:"exclude_commands,omitempty"` // Removidos dos comandos do vendor
+	PromptPatterns  []string   `json:"prompt_patterns,omitempty"`  // Regex do prompt (substitui as do vendor)
+	IgnorePatterns  []string   `json:"ignore_patterns,omitempty"`  // Regex de linhas voláteis (somadas às do vendor)
+	Assets          []Asset    `json:"assets"`
 }
 
 type Asset struct {
@@ -58,18 +89,56 @@ type Asset struct {
 	Password    string `json:"password,omitempty"`     // Override group password
 	PasswordEnv string `json:"password_env,omitempty"` // Override group password_env
 	Active      *bool  `json:"active,omitempty"`       // true|false (default: true)
+
+	PrivateKeyFile string   `json:"private_key_file,omitempty"`           // Override group private_key_file
+	PassphraseEnv  string   `json:"private_key_passphrase_env,omitempty"` // Override group private_key_passphrase_env
+	UseSSHAgent    *bool    `json:"use_ssh_agent,omitempty"`              // Override group use_ssh_agent
+	AuthMethods    []string `json:"auth_methods,omitempty"`               // Override group auth_methods
+
+	SSHLegacy     *SSHLegacy `json:"ssh_legacy,omitempty"`     // Override group/global ssh_legacy
+	CryptoProfile string     `json:"crypto_profile,omitempty"` // Nome em crypto_profiles
+
+	Commands        []string `json:"commands,omitempty"`         // Override group/vendor commands
+	ExtraCommands   []string `json:"extra_commands,omitempty"`   // Somados aos extra_commands do grupo
+	ExcludeCommands []string `json:"exclude_commands,omitempty"` // Somados aos exclude_commands do grupo
+	PromptPatterns  []string `json:"prompt_patterns,omitempty"`  // Override group/vendor prompt_patterns
+	IgnorePatterns  []string `json:"ignore_patterns,omitempty"`  // Somados aos ignore_patterns do grupo
 }
 
 type Job struct {
 	Vendor    string
+	Driver    VendorDriver
+	Commands  []string
+	Prompts   []string
 	Username  string
 	Password  string
+	Auth      SSHAuth
 	Asset     Asset
 	Protocol  string
 	Timeout   time.Duration
 	BaseDir   string
+	Output    OutputConfig
+	Filename  *template.Template
+	RunID     string
+	Group     string
 	Logger    *slog.Logger
 	SSHLegacy *SSHLegacy
+
+	// Linhas voláteis ignoradas no hash e na comparação da configuração
+	IgnorePatterns []string
+
+	// Diretório raiz das coletas (base_dir), onde é procurada a coleta
+	// anterior para comparação
+	ArchiveDir string
+	ConfigDiff bool
+
+	// Repositório git_archive ("" desabilita) e se as coletas com timestamp
+	// deixam de ser gravadas em BaseDir
+	GitArchive  string
+	ArchiveOnly bool
+
+	// Refaz o handshake com algoritmos legacy se não houver algoritmo comum
+	LegacyFallback bool
 }
 
 func main() {
@@ -78,68 +147,89 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 
-	if len(os.Args) < 2 {
-		fmt.Println("Uso: collector <targets.json>")
-		os.Exit(2)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "prune":
+			os.Exit(runPrune(os.Args[2:], logger))
+		case "serve", "daemon":
+			os.Exit(runServe(os.Args[2:], logger))
+		case "convert":
+			os.Exit(runConvert(os.Args[2:], logger))
+		}
+	}
+
+	failThreshold := flag.Float64("fail-threshold", 0, "porcentagem de assets com falha tolerada antes de sair com erro (0-100); assets sem senha configurada contam como falha e, se nenhum asset for coletado, a saída é 4")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Uso: collector [--fail-threshold N] <targets.json>")
+		fmt.Fprintln(flag.CommandLine.Output(), "     collector prune [--dry-run] <targets.json>")
+		fmt.Fprintln(flag.CommandLine.Output(), "     collector serve <targets.json>")
+		fmt.Fprintln(flag.CommandLine.Output(), "     collector convert [-o arquivo] <targets.json>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	if *failThreshold < 0 || *failThreshold > 100 {
+		fmt.Fprintln(os.Stderr, "--fail-threshold deve estar entre 0 e 100")
+		os.Exit(exitUsage)
 	}
 
-	cfgPath := os.Args[1]
+	cfgPath := flag.Arg(0)
 	cfg, err := loadConfig(cfgPath)
 	if err != nil {
 		logger.Error("erro lendo config", "error", err)
-		os.Exit(1)
+		os.Exit(exitConfig)
 	}
 
 	// Validar configuração
 	if err := cfg.Validate(); err != nil {
 		logger.Error("config inválida", "error", err)
-		os.Exit(1)
-	}
-
-	// Defaults
-	if cfg.TimeoutSeconds <= 0 {
-		cfg.TimeoutSeconds = 30
-	}
-	if cfg.Concurrency <= 0 {
-		cfg.Concurrency = 5
-	}
-	if cfg.MaxRetries < 0 {
-		cfg.MaxRetries = 0
-	}
-	if cfg.BaseDir == "" {
-		cfg.BaseDir = "./coletas"
+		os.Exit(exitConfig)
 	}
 
-	// Avisar sobre SSH legacy
-	if cfg.SSHLegacy != nil && cfg.SSHLegacy.Enabled {
-		logger.Warn("SSH legacy mode habilitado - algoritmos antigos/inseguros permitidos",
-			"kex", cfg.SSHLegacy.KexAlgorithms,
-			"ciphers", cfg.SSHLegacy.Ciphers,
-			"macs", cfg.SSHLegacy.MACs,
-		)
-	}
+	cfg.applyDefaults()
 
-	// Criar diretório de saída com data
-	dayDir := time.Now().Format("2006-01-02")
-	outDir := filepath.Join(cfg.BaseDir, dayDir)
-	if err := os.MkdirAll(outDir, 0o755); err != nil {
-		logger.Error("erro criando diretório", "dir", outDir, "error", err)
-		os.Exit(1)
+	c, err := newCollector(cfgPath, cfg, logger)
+	if err != nil {
+		logger.Error("erro preparando coleta", "error", err)
+		os.Exit(exitConfig)
 	}
 
-	logger.Info("iniciando coleta",
-		"config", cfgPath,
-		"output_dir", outDir,
-		"concurrency", cfg.Concurrency,
-		"timeout", cfg.TimeoutSeconds,
-		"max_retries", cfg.MaxRetries,
-		"ssh_legacy", cfg.SSHLegacy != nil && cfg.SSHLegacy.Enabled,
-	)
-
 	// Context com cancelamento (Ctrl+C)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	cancelOnSignal(cancel, logger)
+
+	c.start(ctx)
+	report, err := c.Run(runOptions{})
+	c.stop()
+	if err != nil {
+		logger.Error("erro iniciando coleta", "error", err)
+		os.Exit(exitConfig)
+	}
 
+	code := report.ExitCode(*failThreshold, ctx.Err() != nil)
+	logger.Info("coleta finalizada",
+		"run_id", report.RunID,
+		"success", report.Totals.Success,
+		"failed", report.Totals.Failed,
+		"skipped", report.Totals.Skipped,
+		"inactive", report.Totals.Inactive,
+		"cancelled", report.Totals.Cancelled,
+		"config_changed", report.Totals.Changed,
+		"bytes", report.Totals.Bytes,
+		"duration_ms", report.DurationMs,
+		"exit_code", code,
+	)
+	cancel()
+	os.Exit(code)
+}
+
+// cancelOnSignal cancela o contexto no primeiro SIGINT/SIGTERM.
+func cancelOnSignal(cancel context.CancelFunc, logger *slog.Logger) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -147,136 +237,6 @@ func main() {
 		logger.Warn("sinal de interrupção recebido, cancelando...")
 		cancel()
 	}()
-
-	// Preparar host key callback
-	hostKeyCallback := createHostKeyCallback(cfg.KnownHostsFile, logger)
-
-	// Criar jobs
-	jobs := make(chan Job, len(cfg.Groups)*10)
-	var wg sync.WaitGroup
-
-	// Workers
-	for i := 0; i < cfg.Concurrency; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for job := range jobs {
-				select {
-				case <-ctx.Done():
-					logger.Warn("worker cancelado", "worker_id", workerID)
-					return
-				default:
-				}
-
-				if err := runJobWithRetry(ctx, job, cfg.MaxRetries, hostKeyCallback); err != nil {
-					logger.Error("job falhou",
-						"asset", job.Asset.Name,
-						"vendor", job.Vendor,
-						"address", job.Asset.Address,
-						"protocol", job.Protocol,
-						"error", err,
-					)
-				} else {
-					logger.Info("job concluído",
-						"asset", job.Asset.Name,
-						"vendor", job.Vendor,
-						"address", job.Asset.Address,
-						"protocol", job.Protocol,
-					)
-				}
-			}
-		}(i)
-	}
-
-	// Enfileirar jobs
-	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
-	totalAssets := 0
-	activeAssets := 0
-	inactiveAssets := 0
-
-	for _, g := range cfg.Groups {
-		v := strings.ToLower(strings.TrimSpace(g.Vendor))
-		groupPassword := g.GetPassword()
-
-		for _, a := range g.Assets {
-			totalAssets++
-
-			// Verificar se o asset está ativo
-			if !a.IsActive() {
-				inactiveAssets++
-				logger.Info("asset inativo, ignorando",
-					"asset", a.Name,
-					"address", a.Address,
-				)
-				continue
-			}
-
-			activeAssets++
-
-			// Determinar credenciais (asset override ou group)
-			username := a.Username
-			if username == "" {
-				username = g.Username
-			}
-
-			password := a.GetPassword()
-			if password == "" {
-				password = groupPassword
-			}
-
-			if password == "" {
-				logger.Error("senha não configurada",
-					"asset", a.Name,
-					"vendor", v,
-					"username", username,
-				)
-				continue
-			}
-
-			// Determinar protocolo
-			protocol := strings.ToLower(strings.TrimSpace(a.Protocol))
-			if protocol == "" {
-				protocol = "ssh" // default
-			}
-
-			// Determinar porta
-			port := a.Port
-			if port == 0 {
-				if protocol == "telnet" {
-					port = 23
-				} else {
-					port = 22
-				}
-			}
-
-			// Criar asset com configurações resolvidas
-			resolvedAsset := a
-			resolvedAsset.Port = port
-
-			jobs <- Job{
-				Vendor:    v,
-				Username:  username,
-				Password:  password,
-				Asset:     resolvedAsset,
-				Protocol:  protocol,
-				Timeout:   timeout,
-				BaseDir:   outDir,
-				Logger:    logger,
-				SSHLegacy: cfg.SSHLegacy,
-			}
-		}
-	}
-	close(jobs)
-
-	logger.Info("jobs enfileirados",
-		"total_assets", totalAssets,
-		"active", activeAssets,
-		"inactive", inactiveAssets,
-	)
-
-	// Aguardar conclusão
-	wg.Wait()
-	logger.Info("coleta finalizada")
 }
 
 func loadConfig(path string) (*Config, error) {
@@ -291,6 +251,9 @@ func loadConfig(path string) (*Config, error) {
 	if len(cfg.Groups) == 0 {
 		return nil, errors.New("nenhum grupo definido em groups[]")
 	}
+	if err := cfg.expandInventory(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
@@ -301,25 +264,66 @@ func (c *Config) Validate() error {
 	if c.TimeoutSeconds > 300 {
 		return errors.New("timeout muito alto (max: 300s)")
 	}
+	if err := validateHostKeyPolicy(c.HostKeyPolicy, c.KnownHostsFile); err != nil {
+		return err
+	}
+	if err := c.Output.Validate(); err != nil {
+		return err
+	}
+	if err := c.GitArchive.Validate(); err != nil {
+		return err
+	}
+	if err := c.Retention.Validate(); err != nil {
+		return err
+	}
+	if err := c.API.Validate(); err != nil {
+		return err
+	}
+	if err := c.Metrics.Validate(); err != nil {
+		return err
+	}
 
 	for i, g := range c.Groups {
-		vendor := strings.ToLower(strings.TrimSpace(g.Vendor))
-		if vendor != "huawei" && vendor != "zte" {
-			return fmt.Errorf("grupo[%d]: vendor inválido %q (use huawei ou zte)", i, g.Vendor)
+		if _, ok := lookupVendor(g.Vendor); !ok {
+			return fmt.Errorf("grupo[%d]: vendor inválido %q (use %s)", i, g.Vendor, strings.Join(vendorNames(), ", "))
 		}
 
 		if g.Username == "" {
 			return fmt.Errorf("grupo[%d]: username não pode ser vazio", i)
 		}
 
-		if g.Password == "" && g.PasswordEnv == "" {
-			return fmt.Errorf("grupo[%d]: configure password ou password_env", i)
+		if err := validateSchedule(g.Schedule); err != nil {
+			return fmt.Errorf("grupo[%d].%w", i, err)
+		}
+
+		if g.Password == "" && g.PasswordEnv == "" && g.PrivateKeyFile == "" && !boolValue(g.UseSSHAgent) {
+			return fmt.Errorf("grupo[%d]: configure password, password_env, private_key_file ou use_ssh_agent", i)
+		}
+
+		if err := validateAuthMethods(g.AuthMethods); err != nil {
+			return fmt.Errorf("grupo[%d].%w", i, err)
+		}
+
+		if err := c.validateCryptoProfile(g.SSHLegacy, g.CryptoProfile); err != nil {
+			return fmt.Errorf("grupo[%d]: %w", i, err)
 		}
 
 		if len(g.Assets) == 0 {
 			return fmt.Errorf("grupo[%d]: nenhum asset definido", i)
 		}
 
+		if err := validateCommandFields(g.Commands, g.ExtraCommands, g.ExcludeCommands); err != nil {
+			return fmt.Errorf("grupo[%d].%w", i, err)
+		}
+
+		if err := validatePromptPatterns(g.PromptPatterns); err != nil {
+			return fmt.Errorf("grupo[%d].%w", i, err)
+		}
+
+		if err := validateIgnorePatterns(g.IgnorePatterns); err != nil {
+			return fmt.Errorf("grupo[%d].%w", i, err)
+		}
+
 		for j, a := range g.Assets {
 			if a.Name == "" {
 				return fmt.Errorf("grupo[%d].assets[%d]: name não pode ser vazio", i, j)
@@ -341,11 +345,75 @@ func (c *Config) Validate() error {
 					return fmt.Errorf("grupo[%d].assets[%d]: protocolo inválido %q (use ssh ou telnet)", i, j, a.Protocol)
 				}
 			}
+
+			if err := validateCommandFields(a.Commands, a.ExtraCommands, a.ExcludeCommands); err != nil {
+				return fmt.Errorf("grupo[%d].assets[%d].%w", i, j, err)
+			}
+
+			if err := validatePromptPatterns(a.PromptPatterns); err != nil {
+				return fmt.Errorf("grupo[%d].assets[%d].%w", i, j, err)
+			}
+
+			if err := validateIgnorePatterns(a.IgnorePatterns); err != nil {
+				return fmt.Errorf("grupo[%d].assets[%d].%w", i, j, err)
+			}
+
+			if err := validateAuthMethods(a.AuthMethods); err != nil {
+				return fmt.Errorf("grupo[%d].assets[%d].%w", i, j, err)
+			}
+
+			if err := c.validateCryptoProfile(a.SSHLegacy, a.CryptoProfile); err != nil {
+				return fmt.Errorf("grupo[%d].assets[%d]: %w", i, j, err)
+			}
+
+			if driver, ok := lookupVendor(g.Vendor); ok && len(resolveCommands(driver, g, a)) == 0 {
+				return fmt.Errorf("grupo[%d].assets[%d]: nenhum comando restante após exclude_commands", i, j)
+			}
 		}
 	}
 	return nil
 }
 
+func (c *Config) validateCryptoProfile(legacy *SSHLegacy, profile string) error {
+	if profile == "" {
+		return nil
+	}
+	if legacy != nil {
+		return errors.New("use ssh_legacy ou crypto_profile, não ambos")
+	}
+	if _, ok := c.CryptoProfiles[profile]; !ok {
+		return fmt.Errorf("crypto_profile %q não definido em crypto_profiles", profile)
+	}
+	return nil
+}
+
+// resolveSSHLegacy escolhe o perfil de criptografia do asset: ssh_legacy ou
+// crypto_profile do asset, depois do grupo e por fim o ssh_legacy global.
+func (c *Config) resolveSSHLegacy(g Group, a Asset) *SSHLegacy {
+	if a.SSHLegacy != nil {
+		return a.SSHLegacy
+	}
+	if a.CryptoProfile != "" {
+		return c.CryptoProfiles[a.CryptoProfile]
+	}
+	if g.SSHLegacy != nil {
+		return g.SSHLegacy
+	}
+	if g.CryptoProfile != "" {
+		return c.CryptoProfiles[g.CryptoProfile]
+	}
+	return c.SSHLegacy
+}
+
+// DisplayName identifica o grupo em logs, na API e no filename_template:
+// o name configurado ou, na falta dele, o vendor.
+func (g *Group) DisplayName() string {
+	if g.Name != "" {
+		return g.Name
+	}
+	return normalizeVendor(g.Vendor)
+}
+
 func (g *Group) GetPassword() string {
 	if g.PasswordEnv != "" {
 		if pass := os.Getenv(g.PasswordEnv); pass != "" {
@@ -364,6 +432,103 @@ func (a *Asset) GetPassword() string {
 	return a.Password
 }
 
+// resolveSSHAuth aplica a mesma hierarquia das credenciais: campos do asset
+// sobrescrevem os do grupo.
+func resolveSSHAuth(g Group, a Asset) SSHAuth {
+	auth := SSHAuth{
+		PrivateKeyFile: g.PrivateKeyFile,
+		UseAgent:       boolValue(g.UseSSHAgent),
+		Methods:        g.AuthMethods,
+	}
+	passphraseEnv := g.PassphraseEnv
+
+	if a.PrivateKeyFile != "" {
+		auth.PrivateKeyFile = a.PrivateKeyFile
+	}
+	if a.PassphraseEnv != "" {
+		passphraseEnv = a.PassphraseEnv
+	}
+	if a.UseSSHAgent != nil {
+		auth.UseAgent = *a.UseSSHAgent
+	}
+	if len(a.AuthMethods) > 0 {
+		auth.Methods = a.AuthMethods
+	}
+	if passphraseEnv != "" {
+		auth.Passphrase = os.Getenv(passphraseEnv)
+	}
+	return auth
+}
+
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
+
+// resolveCommands aplica a hierarquia de comandos: asset "commands", grupo
+// "commands" ou os padrões do vendor; depois soma os extra_commands e remove
+// os exclude_commands de grupo e asset.
+func resolveCommands(driver VendorDriver, g Group, a Asset) []string {
+	base := driver.Commands()
+	if len(g.Commands) > 0 {
+		base = g.Commands
+	}
+	if len(a.Commands) > 0 {
+		base = a.Commands
+	}
+
+	excluded := make(map[string]bool)
+	for _, cmd := range append(append([]string{}, g.ExcludeCommands...), a.ExcludeCommands...) {
+		excluded[commandKey(cmd)] = true
+	}
+
+	seen := make(map[string]bool)
+	var cmds []string
+	for _, list := range [][]string{base, g.ExtraCommands, a.ExtraCommands} {
+		for _, cmd := range list {
+			key := commandKey(cmd)
+			if key == "" || seen[key] || excluded[key] {
+				continue
+			}
+			seen[key] = true
+			cmds = append(cmds, strings.TrimSpace(cmd))
+		}
+	}
+	return cmds
+}
+
+func validateCommandFields(commands, extra, exclude []string) error {
+	if err := validateCommandList(commands); err != nil {
+		return fmt.Errorf("commands: %w", err)
+	}
+	if err := validateCommandList(extra); err != nil {
+		return fmt.Errorf("extra_commands: %w", err)
+	}
+	if err := validateCommandList(exclude); err != nil {
+		return fmt.Errorf("exclude_commands: %w", err)
+	}
+	return nil
+}
+
+func validateCommandList(cmds []string) error {
+	seen := make(map[string]bool)
+	for k, cmd := range cmds {
+		key := commandKey(cmd)
+		if key == "" {
+			return fmt.Errorf("comando[%d] vazio", k)
+		}
+		if seen[key] {
+			return fmt.Errorf("comando duplicado %q", cmd)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// commandKey normaliza um comando para comparação (caixa e espaços).
+func commandKey(cmd string) string {
+	return strings.ToLower(strings.Join(strings.Fields(cmd), " "))
+}
+
 func (a *Asset) IsActive() bool {
 	if a.Active == nil {
 		return true // default: ativo
@@ -371,19 +536,36 @@ func (a *Asset) IsActive() bool {
 	return *a.Active
 }
 
-func createHostKeyCallback(knownHostsPath string, logger *slog.Logger) ssh.HostKeyCallback {
+func createHostKeyCallback(cfg *Config, logger *slog.Logger) (ssh.HostKeyCallback, error) {
+	knownHostsPath := cfg.KnownHostsFile
+	policy := strings.ToLower(strings.TrimSpace(cfg.HostKeyPolicy))
+
+	switch policy {
+	case hostKeyInsecure:
+		logger.Warn("host_key_policy=insecure, chaves de host não são verificadas (não recomendado para produção)")
+		return ssh.InsecureIgnoreHostKey(), nil
+	case hostKeyStrict, hostKeyTOFU:
+		store, err := sharedHostKeyStore(knownHostsPath, policy, logger)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("usando known_hosts", "path", knownHostsPath, "host_key_policy", policy)
+		return store.Callback, nil
+	}
+
+	// Sem host_key_policy: comportamento anterior (strict se o arquivo existir)
 	if knownHostsPath != "" {
 		if _, err := os.Stat(knownHostsPath); err == nil {
-			callback, err := knownhosts.New(knownHostsPath)
+			store, err := sharedHostKeyStore(knownHostsPath, hostKeyStrict, logger)
 			if err != nil {
 				logger.Warn("erro carregando known_hosts, usando modo inseguro",
 					"path", knownHostsPath,
 					"error", err,
 				)
-				return ssh.InsecureIgnoreHostKey()
+				return ssh.InsecureIgnoreHostKey(), nil
 			}
 			logger.Info("usando known_hosts", "path", knownHostsPath)
-			return callback
+			return store.Callback, nil
 		}
 		logger.Warn("arquivo known_hosts não encontrado, usando modo inseguro",
 			"path", knownHostsPath,
@@ -391,10 +573,10 @@ func createHostKeyCallback(knownHostsPath string, logger *slog.Logger) ssh.HostK
 	} else {
 		logger.Warn("known_hosts_file não configurado, usando modo inseguro (não recomendado para produção)")
 	}
-	return ssh.InsecureIgnoreHostKey()
+	return ssh.InsecureIgnoreHostKey(), nil
 }
 
-func runJobWithRetry(ctx context.Context, job Job, maxRetries int, hostKeyCallback ssh.HostKeyCallback) error {
+func runJobWithRetry(ctx context.Context, job Job, maxRetries int, hostKeyCallback ssh.HostKeyCallback, res *JobResult) error {
 	var lastErr error
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
@@ -415,38 +597,50 @@ func runJobWithRetry(ctx context.Context, job Job, maxRetries int, hostKeyCallba
 			time.Sleep(backoff)
 		}
 
-		err := runJob(ctx, job, hostKeyCallback)
+		res.Attempts = attempt + 1
+		err := runJob(ctx, job, hostKeyCallback, res)
 		if err == nil {
 			return nil
 		}
+		// Chave divergente não é transitória: não adianta tentar de novo
+		if errors.Is(err, ErrHostKeyMismatch) {
+			return err
+		}
 		lastErr = err
 	}
 
 	return fmt.Errorf("falhou após %d tentativas: %w", maxRetries+1, lastErr)
 }
 
-func runJob(ctx context.Context, job Job, hostKeyCallback ssh.HostKeyCallback) error {
+func runJob(ctx context.Context, job Job, hostKeyCallback ssh.HostKeyCallback, res *JobResult) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
 	}
 
-	cmds, err := commandsForVendor(job.Vendor)
+	if job.Driver == nil {
+		return fmt.Errorf("vendor desconhecido: %q (use %s)", job.Vendor, strings.Join(vendorNames(), ", "))
+	}
+
+	cmds := collectCommands(job.Driver, job.Commands)
+	prompts, err := newPromptMatcher(job.Prompts)
+	if err != nil {
+		return err
+	}
+	ignore, err := newLineFilter(job.IgnorePatterns)
 	if err != nil {
 		return err
 	}
 
-	prompts := promptsForVendor(job.Vendor)
-
-	var out string
+	var out *capture
 
 	// Escolher protocolo
 	switch job.Protocol {
 	case "telnet":
 		out, err = collectTelnet(ctx, job, cmds, prompts)
 	case "ssh":
-		out, err = collectSSH(ctx, job, cmds, prompts, hostKeyCallback)
+		out, err = collectSSH(ctx, job, cmds, prompts, hostKeyCallback, res)
 	default:
 		return fmt.Errorf("protocolo desconhecido: %q (use ssh ou telnet)", job.Protocol)
 	}
@@ -454,112 +648,146 @@ func runJob(ctx context.Context, job Job, hostKeyCallback ssh.HostKeyCallback) e
 	if err != nil {
 		return err
 	}
+	out.End = time.Now()
+	metrics.observeCapture(job, out)
+	if !job.Output.Raw {
+		out.normalize(prompts)
+	}
+	res.ConfigSHA256 = configHash(out, job.Driver, ignore)
+
+	base, err := renderFilename(job.Filename, filenameData{
+		Name:     sanitize(job.Asset.Name),
+		Address:  sanitize(job.Asset.Address),
+		Vendor:   job.Vendor,
+		Protocol: job.Protocol,
+		Group:    sanitize(job.Group),
+		RunID:    job.RunID,
+		Time:     out.Time,
+	})
+	if err != nil {
+		return err
+	}
+	mode := job.Output.mode()
+	if job.ArchiveOnly {
+		mode = ""
+	}
 
-	safeName := sanitize(job.Asset.Name)
-	safeIP := sanitize(job.Asset.Address)
-	timestamp := time.Now().Format("150405") // HHMMSS
-	filename := fmt.Sprintf("%s__%s__%s__%s__%s.txt", safeName, safeIP, job.Vendor, job.Protocol, timestamp)
-	path := filepath.Join(job.BaseDir, filename)
-
-	return writeAtomic(path, []byte(out), 0o644)
-}
-
-func commandsForVendor(vendor string) ([]string, error) {
-	switch vendor {
-	case "huawei":
-		return []string{
-			"screen-length 0 temporary",
-			"display version",
-			"display license",
-			"display current-configuration",
-			"display interface brief",
-			"display interface description",
-			"display interface transceiver",
-			"display lldp neighbor",
-			"display eth-trunk brief",
-			"display bgp peer",
-			"display ospf peer",
-			"display isis peer",
-		}, nil
-	case "zte":
-		return []string{
-			"terminal length 0",
-			"show version",
-			"show license",
-			"show hardware",
-			"show running-config",
-			"show interface brief",
-			"show interface description",
-			"show lldp neighbor",
-			"show opticalinfo brief",
-			"show temperature detail",
-			"show interface summary",
-			"show ip bgp summary",
-			"show ip ospf neighbor",
-			"show isis topology",
-		}, nil
-	default:
-		return nil, fmt.Errorf("vendor desconhecido: %q (use huawei/zte)", vendor)
+	if mode == outputSplit || mode == outputBoth {
+		dir := filepath.Join(job.BaseDir, base)
+		n, err := writeSplit(dir, job, out)
+		if err != nil {
+			return err
+		}
+		res.SplitDir = dir
+		res.Bytes = n
+	}
+	format := job.Output.format()
+	if (mode == outputCombined || mode == outputBoth) && format != formatJSON {
+		combined := out.Combined()
+		path := filepath.Join(job.BaseDir, base+".txt"+compressionExt(job.Output.compression()))
+		if err := writeCompressed(path, []byte(combined), 0o644, job.Output.compression()); err != nil {
+			return err
+		}
+		res.OutputFile = path
+		res.Bytes = len(combined)
+	}
+	if (mode == outputCombined || mode == outputBoth) && format != formatText {
+		data, err := out.JSON(job)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(job.BaseDir, base+".json"+compressionExt(job.Output.compression()))
+		if err := writeCompressed(path, data, 0o644, job.Output.compression()); err != nil {
+			return err
+		}
+		res.JSONFile = path
+		if res.OutputFile == "" {
+			res.Bytes = len(data)
+		}
+	}
+	if job.GitArchive != "" {
+		if err := archiveConfig(job, out, ignore, res); err != nil {
+			return fmt.Errorf("git_archive: %w", err)
+		}
 	}
-}
 
-func promptsForVendor(vendor string) []string {
-	switch vendor {
-	case "huawei":
-		return []string{"<", ">", "]"}
-	case "zte":
-		return []string{"#", ">"}
-	default:
-		return []string{">", "#", "$"}
+	if job.ConfigDiff {
+		compareWithPrevious(job, ignore, out, res)
 	}
+
+	if res.OutputFile != "" || res.SplitDir != "" || res.JSONFile != "" {
+		if err := appendCaptureIndex(job.BaseDir, captureEntry(job, out, res)); err != nil {
+			job.Logger.Warn("erro gravando índice de coletas", "asset", job.Asset.Name, "error", err)
+		}
+	}
+	return nil
 }
 
-func collectTelnet(ctx context.Context, job Job, cmds []string, prompts []string) (string, error) {
-	addr := fmt.Sprintf("%s:%d", job.Asset.Address, job.Asset.Port)
+func collectTelnet(ctx context.Context, job Job, cmds []string, prompts *promptMatcher) (*capture, error) {
+	addr := net.JoinHostPort(job.Asset.Address, strconv.Itoa(job.Asset.Port))
 
 	job.Logger.Info("conectando via telnet", "address", addr)
+	start := time.Now()
 
 	// Conectar
 	conn, err := telnet.DialTimeout("tcp", addr, job.Timeout)
 	if err != nil {
-		return "", fmt.Errorf("dial telnet: %w", err)
+		return nil, fmt.Errorf("dial telnet: %w", err)
 	}
 	defer conn.Close()
 
-	var result bytes.Buffer
+	pager, err := newPagerHandler(job.Driver.PagerPatterns(), conn)
+	if err != nil {
+		return nil, err
+	}
 
 	// Cabeçalho
-	fmt.Fprintf(&result, "### ASSET=%s IP=%s VENDOR=%s PROTOCOL=telnet TIME=%s ###\n\n",
-		job.Asset.Name, job.Asset.Address, job.Vendor, time.Now().Format(time.RFC3339))
+	result := &capture{Time: time.Now()}
+	result.Header = fmt.Sprintf("### ASSET=%s IP=%s VENDOR=%s PROTOCOL=telnet TIME=%s ###\n\n",
+		job.Asset.Name, job.Asset.Address, job.Vendor, result.Time.Format(time.RFC3339))
 
 	// Aguardar prompt de login
-	if err := waitForString(conn, job.Timeout, "sername:", "ogin:"); err != nil {
-		return result.String(), fmt.Errorf("timeout aguardando login prompt: %w", err)
+	login := job.Driver.Login()
+	if err := waitForString(conn, job.Timeout, login.UsernamePrompts...); err != nil {
+		return result, fmt.Errorf("timeout aguardando login prompt: %w", err)
 	}
 
 	// Enviar username
 	if _, err := conn.Write([]byte(job.Username + "\n")); err != nil {
-		return result.String(), fmt.Errorf("erro enviando username: %w", err)
+		return result, fmt.Errorf("erro enviando username: %w", err)
 	}
 
 	// Aguardar prompt de senha
-	if err := waitForString(conn, job.Timeout, "assword:"); err != nil {
-		return result.String(), fmt.Errorf("timeout aguardando password prompt: %w", err)
+	if err := waitForString(conn, job.Timeout, login.PasswordPrompts...); err != nil {
+		return result, fmt.Errorf("timeout aguardando password prompt: %w", err)
 	}
 
 	// Enviar senha
 	if _, err := conn.Write([]byte(job.Password + "\n")); err != nil {
-		return result.String(), fmt.Errorf("erro enviando password: %w", err)
+		return result, fmt.Errorf("erro enviando password: %w", err)
 	}
 
-	// Aguardar prompt inicial do sistema
-	time.Sleep(2 * time.Second)
+	// Aguardar prompt inicial do sistema e aprender o hostname
+	banner, err := readTelnetOutput(conn, job.Timeout, prompts, nil)
+	if err != nil {
+		job.Logger.Warn("timeout aguardando prompt inicial", "error", err)
+		if prompts.LearnUnmatched(banner) {
+			job.Logger.Warn("prompt fora de prompt_patterns, usando a última linha recebida",
+				"asset", job.Asset.Name,
+				"prompt", prompts.Learned(),
+			)
+		}
+	} else if prompts.Learn(banner) {
+		job.Logger.Info("prompt detectado", "asset", job.Asset.Name, "prompt", prompts.Learned())
+	}
+	result.ConnectDuration = time.Since(start)
 
 	// Executar comandos
+	cmds = append(append([]string{}, login.PostLogin...), cmds...)
 	for _, cmd := range cmds {
 		select {
 		case <-ctx.Done():
-			return result.String(), ctx.Err()
+			return result, ctx.Err()
 		default:
 		}
 
@@ -568,7 +796,7 @@ func collectTelnet(ctx context.Context, job Job, cmds []string, prompts []string
 			continue
 		}
 
-		fmt.Fprintf(&result, "\n\n==== CMD: %s ====\n", cmd)
+		result.begin(cmd)
 
 		// Enviar comando
 		if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
@@ -576,11 +804,12 @@ func collectTelnet(ctx context.Context, job Job, cmds []string, prompts []string
 				"cmd", cmd,
 				"error", err,
 			)
+			result.end(err, false)
 			continue
 		}
 
 		// Ler output
-		output, err := readTelnetOutput(conn, job.Timeout, prompts)
+		output, err := readTelnetOutput(conn, job.Timeout, prompts, pager)
 		if err != nil {
 			job.Logger.Warn("erro lendo output do comando",
 				"cmd", cmd,
@@ -588,50 +817,88 @@ func collectTelnet(ctx context.Context, job Job, cmds []string, prompts []string
 			)
 		}
 
-		result.WriteString(output)
+		result.write(output)
+		result.end(err, err != nil)
 	}
 
 	// Sair
-	_, _ = conn.Write([]byte("quit\n"))
+	_, _ = conn.Write([]byte(job.Driver.ExitCommand() + "\n"))
 	time.Sleep(300 * time.Millisecond)
 
-	return result.String(), nil
+	return result, nil
 }
 
-func collectSSH(ctx context.Context, job Job, cmds []string, prompts []string, hostKeyCallback ssh.HostKeyCallback) (string, error) {
-	addr := fmt.Sprintf("%s:%d", job.Asset.Address, job.Asset.Port)
+func collectSSH(ctx context.Context, job Job, cmds []string, prompts *promptMatcher, hostKeyCallback ssh.HostKeyCallback, res *JobResult) (*capture, error) {
+	addr := net.JoinHostPort(job.Asset.Address, strconv.Itoa(job.Asset.Port))
 
 	job.Logger.Info("conectando via ssh", "address", addr)
+	start := time.Now()
+
+	authMethods, closeAgent, err := buildSSHAuthMethods(job.Auth, job.Password, job.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("ssh auth: %w", err)
+	}
+	defer closeAgent()
 
 	sshCfg := &ssh.ClientConfig{
 		User:            job.Username,
-		Auth:            []ssh.AuthMethod{ssh.Password(job.Password)},
+		Auth:            authMethods,
 		HostKeyCallback: hostKeyCallback,
 		Timeout:         job.Timeout,
 	}
 
 	// Aplicar configurações SSH legacy se habilitadas
-	if job.SSHLegacy != nil && job.SSHLegacy.Enabled {
+	legacyEnabled := job.SSHLegacy != nil && job.SSHLegacy.Enabled
+	if legacyEnabled {
 		applySSHLegacyConfig(sshCfg, job.SSHLegacy, job.Logger)
 	}
 
-	dialer := net.Dialer{Timeout: job.Timeout}
-	conn, err := dialer.Dial("tcp", addr)
+	conn, c, chans, reqs, err := dialSSH(addr, sshCfg, job.Timeout)
+	legacyFallback := false
+	if err != nil && !legacyEnabled && job.LegacyFallback && isNoCommonAlgorithm(err) {
+		job.Logger.Warn("handshake sem algoritmo comum, tentando novamente com algoritmos legacy",
+			"asset", job.Asset.Name,
+			"address", job.Asset.Address,
+			"error", err,
+		)
+		legacy := job.SSHLegacy
+		if legacy == nil {
+			legacy = &SSHLegacy{}
+		}
+		applySSHLegacyConfig(sshCfg, legacy, job.Logger)
+		conn, c, chans, reqs, err = dialSSH(addr, sshCfg, job.Timeout)
+		legacyFallback = err == nil
+	}
+	var typeErr *hostKeyTypeError
+	if err != nil && errors.As(err, &typeErr) {
+		if algos := typeErr.algorithms(sshCfg.HostKeyAlgorithms); len(algos) > 0 {
+			job.Logger.Info("chave de host de tipo não registrado, reconectando com os tipos do known_hosts",
+				"asset", job.Asset.Name,
+				"offered", typeErr.Offered,
+				"host_key_algorithms", algos,
+			)
+			sshCfg.HostKeyAlgorithms = algos
+			conn, c, chans, reqs, err = dialSSH(addr, sshCfg, job.Timeout)
+		}
+	}
 	if err != nil {
-		return "", fmt.Errorf("dial tcp: %w", err)
+		return nil, err
 	}
 	defer conn.Close()
-
-	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sshCfg)
-	if err != nil {
-		return "", fmt.Errorf("ssh handshake: %w", err)
+	res.LegacyFallback = legacyFallback
+	if legacyFallback {
+		job.Logger.Warn("asset exigiu fallback para algoritmos SSH legacy",
+			"asset", job.Asset.Name,
+			"address", job.Asset.Address,
+		)
 	}
+	logNegotiatedAlgorithms(c, job, legacyEnabled || legacyFallback)
 	client := ssh.NewClient(c, chans, reqs)
 	defer client.Close()
 
 	sess, err := client.NewSession()
 	if err != nil {
-		return "", fmt.Errorf("new session: %w", err)
+		return nil, fmt.Errorf("new session: %w", err)
 	}
 	defer sess.Close()
 
@@ -642,40 +909,64 @@ func collectSSH(ctx context.Context, job Job, cmds []string, prompts []string, h
 		ssh.TTY_OP_OSPEED: 14400,
 	}
 	if err := sess.RequestPty("vt100", 200, 80, modes); err != nil {
-		return "", fmt.Errorf("request pty: %w", err)
+		return nil, fmt.Errorf("request pty: %w", err)
 	}
 
 	stdin, err := sess.StdinPipe()
 	if err != nil {
-		return "", fmt.Errorf("stdin pipe: %w", err)
+		return nil, fmt.Errorf("stdin pipe: %w", err)
 	}
 
-	stdout, err := sess.StdoutPipe()
+	stdoutPipe, err := sess.StdoutPipe()
 	if err != nil {
-		return "", fmt.Errorf("stdout pipe: %w", err)
+		return nil, fmt.Errorf("stdout pipe: %w", err)
 	}
+	stdout := newSSHReader(stdoutPipe)
+	defer stdout.stop()
+
+	// Cancelamento fecha a conexão, desbloqueando escritas em andamento
+	stopWatch := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stopWatch()
 
 	if err := sess.Shell(); err != nil {
-		return "", fmt.Errorf("start shell: %w", err)
+		return nil, fmt.Errorf("start shell: %w", err)
 	}
 
-	var result bytes.Buffer
+	pager, err := newPagerHandler(job.Driver.PagerPatterns(), stdin)
+	if err != nil {
+		return nil, err
+	}
 
 	// Cabeçalho
-	fmt.Fprintf(&result, "### ASSET=%s IP=%s VENDOR=%s PROTOCOL=ssh TIME=%s ###\n\n",
-		job.Asset.Name, job.Asset.Address, job.Vendor, time.Now().Format(time.RFC3339))
+	fallbackTag := ""
+	if legacyFallback {
+		fallbackTag = " LEGACY_FALLBACK=true"
+	}
+	result := &capture{Time: time.Now(), LegacyFallback: legacyFallback}
+	result.Header = fmt.Sprintf("### ASSET=%s IP=%s VENDOR=%s PROTOCOL=ssh%s TIME=%s ###\n\n",
+		job.Asset.Name, job.Asset.Address, job.Vendor, fallbackTag, result.Time.Format(time.RFC3339))
 
-	// Aguarda prompt inicial
-	_, err = readUntilPrompt(ctx, stdout, 10*time.Second, prompts)
+	// Aguarda prompt inicial e aprende o hostname
+	banner, err := readUntilPrompt(ctx, stdout, 10*time.Second, prompts, nil)
 	if err != nil {
 		job.Logger.Warn("timeout aguardando prompt inicial", "error", err)
+		if prompts.LearnUnmatched(banner) {
+			job.Logger.Warn("prompt fora de prompt_patterns, usando a última linha recebida",
+				"asset", job.Asset.Name,
+				"prompt", prompts.Learned(),
+			)
+		}
+	} else if prompts.Learn(banner) {
+		job.Logger.Info("prompt detectado", "asset", job.Asset.Name, "prompt", prompts.Learned())
 	}
+	result.ConnectDuration = time.Since(start)
 
 	// Executa comandos
+	cmds = append(append([]string{}, job.Driver.Login().PostLogin...), cmds...)
 	for _, cmd := range cmds {
 		select {
 		case <-ctx.Done():
-			return result.String(), ctx.Err()
+			return result, ctx.Err()
 		default:
 		}
 
@@ -684,38 +975,71 @@ func collectSSH(ctx context.Context, job Job, cmds []string, prompts []string, h
 			continue
 		}
 
-		fmt.Fprintf(&result, "\n\n==== CMD: %s ====\n", cmd)
+		result.begin(cmd)
 
 		// Envia comando
 		if _, err := stdin.Write([]byte(cmd + "\n")); err != nil {
-			return result.String(), fmt.Errorf("write cmd %q: %w", cmd, err)
+			result.end(err, false)
+			return result, fmt.Errorf("write cmd %q: %w", cmd, err)
 		}
 
 		// Lê até encontrar prompt
-		output, err := readUntilPrompt(ctx, stdout, job.Timeout, prompts)
+		output, err := readUntilPrompt(ctx, stdout, job.Timeout, prompts, pager)
 		if err != nil {
 			job.Logger.Warn("erro lendo output do comando",
 				"cmd", cmd,
 				"error", err,
 			)
-			result.WriteString(output) // Salva o que conseguiu ler
+			result.write(output) // Salva o que conseguiu ler
+			result.end(err, true)
 			continue
 		}
 
-		result.WriteString(output)
+		result.write(output)
+		result.end(nil, false)
 	}
 
 	// Tenta sair limpo
-	_, _ = stdin.Write([]byte("quit\n"))
+	_, _ = stdin.Write([]byte(job.Driver.ExitCommand() + "\n"))
 	time.Sleep(300 * time.Millisecond)
 
-	return result.String(), nil
+	return result, nil
+}
+
+// dialSSH abre a conexão TCP e faz o handshake SSH. Em caso de erro a
+// conexão TCP já é fechada.
+func dialSSH(addr string, sshCfg *ssh.ClientConfig, timeout time.Duration) (net.Conn, ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("dial tcp: %w", err)
+	}
+
+	// Sem deadline, um equipamento que aceita a conexão e não responde
+	// prenderia o worker (e a coleta seguinte do asset no modo serve)
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sshCfg)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, nil, fmt.Errorf("ssh handshake: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, c, chans, reqs, nil
+}
+
+// isNoCommonAlgorithm informa se o handshake falhou por falta de algoritmo
+// em comum (kex, host key, cifra ou MAC).
+func isNoCommonAlgorithm(err error) bool {
+	var negErr *ssh.AlgorithmNegotiationError
+	return errors.As(err, &negErr)
 }
 
 func applySSHLegacyConfig(cfg *ssh.ClientConfig, legacy *SSHLegacy, logger *slog.Logger) {
-	// Configurações padrão para equipamentos antigos se não especificadas
-	if len(legacy.KexAlgorithms) == 0 {
-		legacy.KexAlgorithms = []string{
+	// Configurações padrão para equipamentos antigos se não especificadas.
+	// Não altera o *SSHLegacy recebido, que é compartilhado entre workers.
+	kex := legacy.KexAlgorithms
+	if len(kex) == 0 {
+		kex = []string{
 			"diffie-hellman-group-exchange-sha256",
 			"diffie-hellman-group-exchange-sha1",
 			"diffie-hellman-group14-sha1",
@@ -723,8 +1047,9 @@ func applySSHLegacyConfig(cfg *ssh.ClientConfig, legacy *SSHLegacy, logger *slog
 		}
 	}
 
-	if len(legacy.Ciphers) == 0 {
-		legacy.Ciphers = []string{
+	ciphers := legacy.Ciphers
+	if len(ciphers) == 0 {
+		ciphers = []string{
 			"aes128-ctr",
 			"aes192-ctr",
 			"aes256-ctr",
@@ -735,8 +1060,9 @@ func applySSHLegacyConfig(cfg *ssh.ClientConfig, legacy *SSHLegacy, logger *slog
 		}
 	}
 
-	if len(legacy.MACs) == 0 {
-		legacy.MACs = []string{
+	macs := legacy.MACs
+	if len(macs) == 0 {
+		macs = []string{
 			"hmac-sha2-256",
 			"hmac-sha2-512",
 			"hmac-sha1",
@@ -744,23 +1070,53 @@ func applySSHLegacyConfig(cfg *ssh.ClientConfig, legacy *SSHLegacy, logger *slog
 		}
 	}
 
-	if len(legacy.HostKeyAlgorithms) == 0 {
-		legacy.HostKeyAlgorithms = []string{
+	hostKeys := legacy.HostKeyAlgorithms
+	if len(hostKeys) == 0 {
+		hostKeys = []string{
+			"ssh-ed25519",
+			"ecdsa-sha2-nistp256",
+			"ecdsa-sha2-nistp384",
+			"ecdsa-sha2-nistp521",
+			"rsa-sha2-512",
+			"rsa-sha2-256",
 			"ssh-rsa",
 			"ssh-dss",
 		}
 	}
 
 	// Aplicar configurações
-	cfg.Config.KeyExchanges = legacy.KexAlgorithms
-	cfg.Config.Ciphers = legacy.Ciphers
-	cfg.Config.MACs = legacy.MACs
+	cfg.Config.KeyExchanges = kex
+	cfg.Config.Ciphers = ciphers
+	cfg.Config.MACs = macs
+	cfg.HostKeyAlgorithms = hostKeys
 
 	logger.Warn("configurações SSH legacy aplicadas",
-		"kex", legacy.KexAlgorithms,
-		"ciphers", legacy.Ciphers,
-		"macs", legacy.MACs,
-		"host_keys", legacy.HostKeyAlgorithms,
+		"kex", kex,
+		"ciphers", ciphers,
+		"macs", macs,
+		"host_keys", hostKeys,
+	)
+}
+
+// logNegotiatedAlgorithms registra os algoritmos acordados no handshake, para
+// acompanhar quais equipamentos ainda dependem de criptografia legada.
+func logNegotiatedAlgorithms(conn ssh.Conn, job Job, legacy bool) {
+	meta, ok := conn.(ssh.AlgorithmsConnMetadata)
+	if !ok {
+		return
+	}
+	algs := meta.Algorithms()
+	job.Logger.Info("handshake ssh negociado",
+		"asset", job.Asset.Name,
+		"address", job.Asset.Address,
+		"server_version", string(conn.ServerVersion()),
+		"kex", algs.KeyExchange,
+		"host_key", algs.HostKey,
+		"cipher_c2s", algs.Write.Cipher,
+		"cipher_s2c", algs.Read.Cipher,
+		"mac_c2s", algs.Write.MAC,
+		"mac_s2c", algs.Read.MAC,
+		"ssh_legacy", legacy,
 	)
 }
 
@@ -799,13 +1155,13 @@ func waitForString(conn *telnet.Conn, timeout time.Duration, patterns ...string)
 	}
 }
 
-func readTelnetOutput(conn *telnet.Conn, timeout time.Duration, prompts []string) (string, error) {
+func readTelnetOutput(conn *telnet.Conn, timeout time.Duration, prompts *promptMatcher, pager *pagerHandler) (string, error) {
 	deadline := time.Now().Add(timeout)
 	var buf bytes.Buffer
 
 	for {
 		if time.Now().After(deadline) {
-			return buf.String(), fmt.Errorf("timeout lendo output")
+			return pager.Clean(buf.String()), fmt.Errorf("timeout lendo output")
 		}
 
 		data := make([]byte, 4096)
@@ -814,13 +1170,20 @@ func readTelnetOutput(conn *telnet.Conn, timeout time.Duration, prompts []string
 
 		if n > 0 {
 			buf.Write(data[:n])
-			output := buf.String()
+
+			// Paginação: responde com espaço e renova o prazo
+			paged, perr := pager.Handle(&buf)
+			if perr != nil {
+				return pager.Clean(buf.String()), perr
+			}
+			if paged {
+				deadline = time.Now().Add(timeout)
+				continue
+			}
 
 			// Verificar se encontrou prompt
-			for _, prompt := range prompts {
-				if strings.Contains(output, prompt) {
-					return output, nil
-				}
+			if prompts.Match(buf.String()) {
+				return pager.Clean(buf.String()), nil
 			}
 		}
 
@@ -828,59 +1191,87 @@ func readTelnetOutput(conn *telnet.Conn, timeout time.Duration, prompts []string
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				continue
 			}
-			return buf.String(), nil
+			return pager.Clean(buf.String()), nil
 		}
 
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
-func readUntilPrompt(ctx context.Context, reader io.Reader, timeout time.Duration, prompts []string) (string, error) {
-	var buf bytes.Buffer
-	deadline := time.Now().Add(timeout)
-	tmpBuf := make([]byte, 4096)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return buf.String(), ctx.Err()
-		default:
-		}
+// sshReader lê a saída da sessão em uma goroutine. O ssh.Channel não tem
+// SetReadDeadline, então um Read direto ficaria bloqueado enquanto o
+// equipamento não enviasse nada; com os dados chegando por canal,
+// readUntilPrompt pode aplicar o timeout e o cancelamento.
+type sshReader struct {
+	chunks chan []byte
+	err    error // Válido após o fechamento de chunks
+	done   chan struct{}
+}
 
-		if time.Now().After(deadline) {
-			return buf.String(), fmt.Errorf("timeout aguardando prompt")
+func newSSHReader(r io.Reader) *sshReader {
+	sr := &sshReader{chunks: make(chan []byte), done: make(chan struct{})}
+	go func() {
+		defer close(sr.chunks)
+		for {
+			buf := make([]byte, 4096)
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case sr.chunks <- buf[:n]:
+				case <-sr.done:
+					return
+				}
+			}
+			if err != nil {
+				sr.err = err
+				return
+			}
 		}
+	}()
+	return sr
+}
 
-		// Define timeout de leitura
-		if conn, ok := reader.(interface{ SetReadDeadline(time.Time) error }); ok {
-			_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
-		}
+// stop libera a goroutine de leitura; a sessão deve ser fechada em seguida
+// para desbloquear um Read em andamento.
+func (sr *sshReader) stop() {
+	close(sr.done)
+}
 
-		n, err := reader.Read(tmpBuf)
-		if n > 0 {
-			buf.Write(tmpBuf[:n])
+func readUntilPrompt(ctx context.Context, reader *sshReader, timeout time.Duration, prompts *promptMatcher, pager *pagerHandler) (string, error) {
+	var buf bytes.Buffer
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
-			// Verifica se encontrou prompt
-			output := buf.String()
-			for _, prompt := range prompts {
-				if strings.Contains(output, prompt) {
-					return output, nil
+	for {
+		select {
+		case <-ctx.Done():
+			return pager.Clean(buf.String()), ctx.Err()
+		case <-timer.C:
+			return pager.Clean(buf.String()), fmt.Errorf("timeout aguardando prompt")
+		case data, ok := <-reader.chunks:
+			if !ok {
+				if reader.err == nil || reader.err == io.EOF {
+					return pager.Clean(buf.String()), nil
 				}
+				return pager.Clean(buf.String()), reader.err
 			}
-		}
+			buf.Write(data)
 
-		if err != nil {
-			if err == io.EOF {
-				return buf.String(), nil
+			// Paginação: responde com espaço e renova o prazo
+			paged, perr := pager.Handle(&buf)
+			if perr != nil {
+				return pager.Clean(buf.String()), perr
 			}
-			// Ignora timeout errors, continua tentando
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			if paged {
+				timer.Reset(timeout)
 				continue
 			}
-			return buf.String(), err
-		}
 
-		time.Sleep(100 * time.Millisecond)
+			// Verifica se encontrou prompt
+			if prompts.Match(buf.String()) {
+				return pager.Clean(buf.String()), nil
+			}
+		}
 	}
 }
 
@@ -893,6 +1284,7 @@ func sanitize(s string) string {
 	return s
 }
 
+// writeAtomic grava via arquivo temporário e rename.
 func writeAtomic(path string, data []byte, perm fs.FileMode) error {
 	dir := filepath.Dir(path)
 	tmp, err := os.CreateTemp(dir, ".tmp-collect-*")
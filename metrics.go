@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsConfig expõe métricas no formato de texto do Prometheus: em
+// /metrics no modo serve e/ou em um arquivo para o textfile collector do
+// node_exporter, regravado ao fim de cada execução.
+type MetricsConfig struct {
+	Listen       string `json:"listen,omitempty"`        // Ex: ":9273" (apenas modo serve)
+	TextfilePath string `json:"textfile_path,omitempty"` // Ex: /var/lib/node_exporter/collector.prom
+}
+
+func (m *MetricsConfig) Validate() error {
+	if m == nil {
+		return nil
+	}
+	if strings.TrimSpace(m.Listen) == "" && strings.TrimSpace(m.TextfilePath) == "" {
+		return errors.New("metrics: configure listen ou textfile_path")
+	}
+	if m.TextfilePath != "" && !strings.HasSuffix(m.TextfilePath, ".prom") {
+		return errors.New("metrics.textfile_path deve terminar em .prom")
+	}
+	return nil
+}
+
+// Buckets (segundos) dos histogramas de duração.
+var (
+	jobBuckets     = []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+	connectBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	commandBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+)
+
+// metrics é o registro global, alimentado pelos workers.
+var metrics = newCollectorMetrics()
+
+type collectorMetrics struct {
+	jobsStarted     *metricVec
+	jobsFinished    *metricVec
+	jobFailures     *metricVec
+	jobRetries      *metricVec
+	jobDuration     *metricVec
+	connectDuration *metricVec
+	commandDuration *metricVec
+	bytesCollected  *metricVec
+	lastSuccess     *metricVec
+	configChanges   *metricVec
+}
+
+func newCollectorMetrics() *collectorMetrics {
+	return &collectorMetrics{
+		jobsStarted: newMetricVec("collector_jobs_started_total", "counter",
+			"Jobs de coleta iniciados.", nil, "vendor", "protocol"),
+		jobsFinished: newMetricVec("collector_jobs_finished_total", "counter",
+			"Jobs de coleta finalizados, por status (success, failed, cancelled).", nil, "vendor", "protocol", "status"),
+		jobFailures: newMetricVec("collector_job_failures_total", "counter",
+			"Jobs de coleta com falha, por classe de erro.", nil, "vendor", "protocol", "error_class"),
+		jobRetries: newMetricVec("collector_job_retries_total", "counter",
+			"Novas tentativas feitas após falha de um job.", nil, "vendor", "protocol"),
+		jobDuration: newMetricVec("collector_job_duration_seconds", "histogram",
+			"Duração dos jobs de coleta, incluindo novas tentativas.", jobBuckets, "vendor", "protocol"),
+		connectDuration: newMetricVec("collector_connect_duration_seconds", "histogram",
+			"Tempo até a sessão estar pronta para comandos (conexão, handshake e login).", connectBuckets, "vendor", "protocol"),
+		commandDuration: newMetricVec("collector_command_duration_seconds", "histogram",
+			"Duração de cada comando coletado.", commandBuckets, "vendor", "protocol"),
+		bytesCollected: newMetricVec("collector_bytes_collected_total", "counter",
+			"Bytes de saída gravados.", nil, "vendor", "protocol"),
+		lastSuccess: newMetricVec("collector_last_success_timestamp_seconds", "gauge",
+			"Horário (unix) da última coleta bem-sucedida do asset.", nil, "asset", "address", "vendor"),
+		configChanges: newMetricVec("collector_config_changes_total", "counter",
+			"Coletas em que a configuração mudou em relação à anterior.", nil, "asset", "vendor"),
+	}
+}
+
+// observeJob registra o resultado de um job concluído.
+func (m *collectorMetrics) observeJob(res JobResult) {
+	m.jobsFinished.add(1, res.Vendor, res.Protocol, res.Status)
+	if res.Status == statusFailed {
+		m.jobFailures.add(1, res.Vendor, res.Protocol, res.ErrorClass)
+	}
+	if res.Attempts > 1 {
+		m.jobRetries.add(float64(res.Attempts-1), res.Vendor, res.Protocol)
+	}
+	if !res.StartedAt.IsZero() {
+		m.jobDuration.observe(float64(res.DurationMs)/1000, res.Vendor, res.Protocol)
+	}
+	if res.Status == statusSuccess {
+		m.bytesCollected.add(float64(res.Bytes), res.Vendor, res.Protocol)
+		m.lastSuccess.set(float64(res.StartedAt.Add(time.Duration(res.DurationMs)*time.Millisecond).Unix()), res.Asset, res.Address, res.Vendor)
+	}
+	if res.ConfigChanged != nil && *res.ConfigChanged {
+		m.configChanges.add(1, res.Asset, res.Vendor)
+	}
+}
+
+// observeCapture registra os tempos de conexão e de cada comando.
+func (m *collectorMetrics) observeCapture(job Job, c *capture) {
+	if c.ConnectDuration > 0 {
+		m.connectDuration.observe(c.ConnectDuration.Seconds(), job.Vendor, job.Protocol)
+	}
+	for _, cmd := range c.Commands {
+		m.commandDuration.observe(cmd.Duration.Seconds(), job.Vendor, job.Protocol)
+	}
+}
+
+func (m *collectorMetrics) write(w io.Writer) error {
+	for _, v := range []*metricVec{
+		m.jobsStarted, m.jobsFinished, m.jobFailures, m.jobRetries, m.jobDuration,
+		m.connectDuration, m.commandDuration, m.bytesCollected, m.lastSuccess, m.configChanges,
+	} {
+		if err := v.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTextfile grava as métricas para o textfile collector; a escrita é
+// atômica para que o node_exporter nunca leia um arquivo pela metade.
+func (m *collectorMetrics) writeTextfile(path string) error {
+	var buf bytes.Buffer
+	if err := m.write(&buf); err != nil {
+		return err
+	}
+	return writeAtomic(path, buf.Bytes(), 0o644)
+}
+
+var lastSuccessRe = regexp.MustCompile(`^collector_last_success_timestamp_seconds\{asset="((?:[^"\\]|\\.)*)",address="((?:[^"\\]|\\.)*)",vendor="((?:[^"\\]|\\.)*)"\} (\S+)$`)
+
+var labelUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n")
+
+// restoreLastSuccess recupera do textfile anterior o horário da última
+// coleta bem-sucedida de cada asset: no modo one-shot cada processo começa
+// do zero, e um asset que falhar nesta execução não pode perder o valor.
+func (m *collectorMetrics) restoreLastSuccess(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		sub := lastSuccessRe.FindStringSubmatch(line)
+		if sub == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(sub[4], 64)
+		if err != nil {
+			continue
+		}
+		m.lastSuccess.set(value, labelUnescaper.Replace(sub[1]), labelUnescaper.Replace(sub[2]), labelUnescaper.Replace(sub[3]))
+	}
+	return nil
+}
+
+func (m *collectorMetrics) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := m.write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+// metricVec é uma métrica com labels (counter, gauge ou histogram) no
+// formato de texto do Prometheus.
+type metricVec struct {
+	name    string
+	kind    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64  // counter/gauge; soma no histogram
+	counts []uint64 // Contagem por bucket (não acumulada)
+	count  uint64
+}
+
+func newMetricVec(name, kind, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{
+		name:    name,
+		kind:    kind,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+}
+
+func (v *metricVec) get(values []string) *metricSeries {
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &metricSeries{labels: values, counts: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *metricVec) add(delta float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(values).value += delta
+}
+
+func (v *metricVec) set(value float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(values).value = value
+}
+
+func (v *metricVec) observe(value float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.get(values)
+	s.value += value
+	s.count++
+	for i, le := range v.buckets {
+		if value <= le {
+			s.counts[i]++
+			break
+		}
+	}
+}
+
+func (v *metricVec) write(w io.Writer) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := v.series[k]
+		if v.kind != "histogram" {
+			fmt.Fprintf(&sb, "%s%s %s\n", v.name, formatLabels(v.labels, s.labels, "", ""), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, le := range v.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(&sb, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, s.labels, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(&sb, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(&sb, "%s_sum%s %s\n", v.name, formatLabels(v.labels, s.labels, "", ""), formatFloat(s.value))
+		fmt.Fprintf(&sb, "%s_count%s %d\n", v.name, formatLabels(v.labels, s.labels, "", ""), s.count)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, n, labelEscaper.Replace(values[i])))
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
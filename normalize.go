@@ -0,0 +1,140 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ansiRe casa sequências de escape VT100/ANSI: CSI ("ESC[...m", "ESC[2K"),
+// OSC terminadas em BEL/ST, seleção de charset e escapes de um caractere.
+var ansiRe = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[=>78DEHMc]`)
+
+// Bytes do protocolo telnet (RFC 854) que podem sobrar na saída.
+const (
+	telnetIAC  = 0xff
+	telnetSB   = 0xfa
+	telnetSE   = 0xf0
+	telnetWILL = 0xfb
+	telnetDONT = 0xfe
+)
+
+// normalizeOutput limpa a saída de um comando para que a configuração salva
+// possa ser comparada e restaurada: remove sequências IAC do telnet, escapes
+// ANSI, backspaces e "\r", a linha com o eco do comando e o prompt final
+// (reconhecido pelos padrões do vendor/asset).
+func normalizeOutput(cmd, output string, prompts *promptMatcher) string {
+	output = stripTelnetIAC(output)
+	output = ansiRe.ReplaceAllString(output, "")
+	output = applyBackspaces(output)
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	output = strings.ReplaceAll(output, "\r", "")
+	output = stripControlChars(output)
+
+	lines := strings.Split(output, "\n")
+
+	// Eco do comando, possivelmente precedido do prompt
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if isCommandEcho(line, cmd) {
+			lines = lines[i+1:]
+		}
+		break
+	}
+
+	// Prompt final
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if n := len(lines); n > 0 && prompts != nil && prompts.Match(lines[n-1]) {
+		lines = lines[:n-1]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func isCommandEcho(line, cmd string) bool {
+	lineKey, cmdKey := commandKey(line), commandKey(cmd)
+	if lineKey == cmdKey {
+		return true
+	}
+	return strings.HasSuffix(lineKey, cmdKey) && strings.ContainsAny(lineKey[:len(lineKey)-len(cmdKey)], "<>[]#$%")
+}
+
+// stripTelnetIAC remove comandos IAC (incluindo negociações WILL/WONT/DO/DONT
+// e subnegociações SB ... SE) que não foram consumidos pela biblioteca.
+func stripTelnetIAC(s string) string {
+	if strings.IndexByte(s, telnetIAC) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != telnetIAC || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch c := s[i+1]; {
+		case c == telnetIAC: // IAC IAC é o byte 0xff literal
+			b.WriteByte(telnetIAC)
+			i++
+		case c == telnetSB:
+			end := strings.Index(s[i:], string([]byte{telnetIAC, telnetSE}))
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 1
+		case c >= telnetWILL && c <= telnetDONT:
+			i += 2
+		default:
+			i++
+		}
+	}
+	return b.String()
+}
+
+// applyBackspaces aplica "\b" apagando o caractere anterior. Trabalha sobre
+// bytes para preservar bytes inválidos em UTF-8 (comuns em banners e
+// descrições), que um range sobre runas trocaria por U+FFFD.
+func applyBackspaces(s string) string {
+	if strings.IndexByte(s, '\b') < 0 {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\b' {
+			out = append(out, c)
+			continue
+		}
+		if len(out) == 0 || out[len(out)-1] == '\n' {
+			continue
+		}
+		// Um caractere UTF-8 válido é apagado por inteiro; um byte
+		// inválido, sozinho
+		_, size := utf8.DecodeLastRune(out)
+		out = out[:len(out)-size]
+	}
+	return string(out)
+}
+
+// stripControlChars remove caracteres de controle restantes, exceto "\n" e
+// "\t". Como em applyBackspaces, os demais bytes são mantidos intactos.
+func stripControlChars(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < 0x20 && c != '\n' && c != '\t') || c == 0x7f {
+			continue
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
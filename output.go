@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Modos aceitos em output.mode.
+const (
+	outputCombined = "combined" // Um único .txt com separadores "==== CMD:" (padrão)
+	outputSplit    = "split"    // Um diretório por asset com um arquivo por comando
+	outputBoth     = "both"
+)
+
+// Formatos aceitos em output.format para a coleta combinada.
+const (
+	formatText = "text" // Cabeçalho "### ASSET=... ###" e separadores "==== CMD:" (padrão)
+	formatJSON = "json" // Documento JSON com metadados e um registro por comando
+	formatBoth = "both"
+)
+
+// OutputConfig controla como as coletas são gravadas.
+type OutputConfig struct {
+	Mode string `json:"mode,omitempty"` // "combined" | "split" | "both" (default: "combined")
+	Raw  bool   `json:"raw,omitempty"`  // Grava a saída sem normalização (eco, prompt, ANSI, \r)
+
+	// Formato da coleta combinada: "text" | "json" | "both" (default: "text").
+	// O modo split não é afetado.
+	Format string `json:"format,omitempty"`
+
+	Compression string `json:"compression,omitempty"` // "gzip" | "zstd" (default: sem compressão)
+
+	// Template (text/template) do nome da coleta, sem extensão. Campos:
+	// Name, Address, Vendor, Protocol, Group, RunID e Time (time.Time).
+	FilenameTemplate string `json:"filename_template,omitempty"`
+}
+
+// defaultFilenameTemplate inclui data, hora e o ID da execução: duas
+// execuções no mesmo segundo não sobrescrevem uma à outra.
+const defaultFilenameTemplate = `{{.Name}}__{{.Address}}__{{.Vendor}}__{{.Protocol}}__{{.Time.Format "20060102-150405"}}__{{.RunID}}`
+
+// filenameData são os campos disponíveis em output.filename_template. Os
+// textos já vêm sanitizados para uso em nome de arquivo.
+type filenameData struct {
+	Name     string
+	Address  string
+	Vendor   string
+	Protocol string
+	Group    string
+	RunID    string
+	Time     time.Time
+}
+
+func (o OutputConfig) filenameTemplate() (*template.Template, error) {
+	text := o.FilenameTemplate
+	if strings.TrimSpace(text) == "" {
+		text = defaultFilenameTemplate
+	}
+	tmpl, err := template.New("filename").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("output.filename_template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderFilename executa o template e rejeita nomes vazios ou com
+// separadores de diretório.
+func renderFilename(tmpl *template.Template, data filenameData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("output.filename_template: %w", err)
+	}
+	name := strings.TrimSpace(sb.String())
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("output.filename_template: nome inválido %q", name)
+	}
+	return name, nil
+}
+
+func (o OutputConfig) mode() string {
+	if m := strings.ToLower(strings.TrimSpace(o.Mode)); m != "" {
+		return m
+	}
+	return outputCombined
+}
+
+func (o OutputConfig) format() string {
+	if f := strings.ToLower(strings.TrimSpace(o.Format)); f != "" {
+		return f
+	}
+	return formatText
+}
+
+func (o OutputConfig) compression() string {
+	return strings.ToLower(strings.TrimSpace(o.Compression))
+}
+
+func (o OutputConfig) Validate() error {
+	switch o.mode() {
+	case outputCombined, outputSplit, outputBoth:
+	default:
+		return fmt.Errorf("output.mode inválido %q (use %s, %s ou %s)", o.Mode, outputCombined, outputSplit, outputBoth)
+	}
+	switch o.format() {
+	case formatText, formatJSON, formatBoth:
+	default:
+		return fmt.Errorf("output.format inválido %q (use %s, %s ou %s)", o.Format, formatText, formatJSON, formatBoth)
+	}
+	if err := validateCompression(o.Compression); err != nil {
+		return err
+	}
+
+	tmpl, err := o.filenameTemplate()
+	if err != nil {
+		return err
+	}
+	_, err = renderFilename(tmpl, filenameData{
+		Name: "asset", Address: "10.0.0.1", Vendor: "vendor", Protocol: "ssh",
+		Group: "grupo", RunID: "run", Time: time.Now(),
+	})
+	return err
+}
+
+// capture guarda a saída de cada comando separadamente, para que possa ser
+// gravada tanto no arquivo combinado quanto em arquivos por comando.
+type capture struct {
+	Header         string
+	Time           time.Time
+	End            time.Time
+	LegacyFallback bool
+	// Tempo até a sessão estar pronta: conexão, handshake/login e prompt
+	ConnectDuration time.Duration
+	Commands        []commandOutput
+}
+
+type commandOutput struct {
+	Command   string
+	Output    string
+	Started   time.Time
+	Duration  time.Duration
+	Truncated bool   // A leitura parou antes do prompt (timeout, conexão fechada)
+	Error     string // Erro de envio ou leitura do comando
+}
+
+// begin abre a seção de um comando; write acrescenta saída à última seção
+// e end a encerra, registrando a duração e o erro, se houver.
+func (c *capture) begin(cmd string) {
+	c.Commands = append(c.Commands, commandOutput{Command: cmd, Started: time.Now()})
+}
+
+func (c *capture) write(output string) {
+	if len(c.Commands) == 0 {
+		return
+	}
+	c.Commands[len(c.Commands)-1].Output += output
+}
+
+func (c *capture) end(err error, truncated bool) {
+	if len(c.Commands) == 0 {
+		return
+	}
+	cmd := &c.Commands[len(c.Commands)-1]
+	cmd.Duration = time.Since(cmd.Started)
+	cmd.Truncated = truncated
+	if err != nil {
+		cmd.Error = err.Error()
+	}
+}
+
+// configCommand retorna a seção do ConfigCommand do vendor, se coletada.
+func (c *capture) configCommand(driver VendorDriver) *commandOutput {
+	key := commandKey(driver.ConfigCommand())
+	if key == "" {
+		return nil
+	}
+	for i := range c.Commands {
+		if commandKey(c.Commands[i].Command) == key {
+			return &c.Commands[i]
+		}
+	}
+	return nil
+}
+
+// complete informa se o comando terminou no prompt, sem erro.
+func (o *commandOutput) complete() bool {
+	return !o.Truncated && o.Error == ""
+}
+
+// normalize aplica normalizeOutput à saída de cada comando.
+func (c *capture) normalize(prompts *promptMatcher) {
+	for i := range c.Commands {
+		c.Commands[i].Output = normalizeOutput(c.Commands[i].Command, c.Commands[i].Output, prompts)
+	}
+}
+
+// Combined monta o formato tradicional: cabeçalho "### ASSET=... ###" e a
+// saída de cada comando após "==== CMD: <comando> ====".
+func (c *capture) Combined() string {
+	var sb strings.Builder
+	sb.WriteString(c.Header)
+	for _, cmd := range c.Commands {
+		fmt.Fprintf(&sb, "\n\n==== CMD: %s ====\n", cmd.Command)
+		sb.WriteString(cmd.Output)
+	}
+	return sb.String()
+}
+
+// splitManifest é gravado como manifest.json no diretório do asset.
+type splitManifest struct {
+	Asset    string          `json:"asset"`
+	Address  string          `json:"address"`
+	Vendor   string          `json:"vendor"`
+	Protocol string          `json:"protocol"`
+	Time     time.Time       `json:"time"`
+	Files    []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Command string `json:"command"`
+	File    string `json:"file"`
+	Bytes   int    `json:"bytes"`
+}
+
+var slugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugifyCommand transforma o comando em nome de arquivo, ex:
+// "display current-configuration" -> "display-current-configuration".
+func slugifyCommand(cmd string) string {
+	slug := strings.Trim(slugRe.ReplaceAllString(strings.ToLower(cmd), "-"), "-")
+	if slug == "" {
+		slug = "cmd"
+	}
+	return slug
+}
+
+// writeSplit grava um arquivo por comando em dir e, por último, o
+// manifest.json. Retorna o total de bytes gravados nos arquivos de comando.
+func writeSplit(dir string, job Job, c *capture) (int, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+
+	manifest := splitManifest{
+		Asset:    job.Asset.Name,
+		Address:  job.Asset.Address,
+		Vendor:   job.Vendor,
+		Protocol: job.Protocol,
+		Time:     c.Time,
+	}
+	compression := job.Output.compression()
+	ext := ".txt" + compressionExt(compression)
+	used := make(map[string]bool)
+	total := 0
+	for _, cmd := range c.Commands {
+		slug := slugifyCommand(cmd.Command)
+		name := slug + ext
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d%s", slug, n, ext)
+		}
+		used[name] = true
+
+		if err := writeCompressed(filepath.Join(dir, name), []byte(cmd.Output), 0o644, compression); err != nil {
+			return total, err
+		}
+		total += len(cmd.Output)
+		manifest.Files = append(manifest.Files, manifestEntry{Command: cmd.Command, File: name, Bytes: len(cmd.Output)})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return total, err
+	}
+	return total, writeAtomic(filepath.Join(dir, "manifest.json"), append(data, '\n'), 0o644)
+}
+
+// readSplitCombined remonta uma coleta split no formato combinado, a
+// partir do manifest.json de dir.
+func readSplitCombined(dir string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest splitManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	c := &capture{
+		Header: fmt.Sprintf("### ASSET=%s IP=%s VENDOR=%s PROTOCOL=%s TIME=%s ###\n\n",
+			manifest.Asset, manifest.Address, manifest.Vendor, manifest.Protocol, manifest.Time.Format(time.RFC3339)),
+	}
+	for _, f := range manifest.Files {
+		out, err := readCaptureFile(filepath.Join(dir, f.File))
+		if err != nil {
+			return nil, err
+		}
+		c.Commands = append(c.Commands, commandOutput{Command: f.Command, Output: string(out)})
+	}
+	return []byte(c.Combined()), nil
+}
+
+// readSplitCommand lê a saída de cmd a partir do manifest.json de dir.
+func readSplitCommand(dir, cmd string) (string, bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return "", false, err
+	}
+	var manifest splitManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", false, fmt.Errorf("%s: %w", dir, err)
+	}
+	key := commandKey(cmd)
+	for _, f := range manifest.Files {
+		if commandKey(f.Command) != key {
+			continue
+		}
+		out, err := readCaptureFile(filepath.Join(dir, f.File))
+		if err != nil {
+			return "", false, err
+		}
+		return strings.Trim(string(out), "\n"), true, nil
+	}
+	return "", false, nil
+}
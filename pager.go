@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// pagerEraseRe casa as sequências que o equipamento envia para apagar o
+// marcador de paginação depois do espaço: backspaces ou "ESC[nD" seguidos de
+// espaços e de novo retorno do cursor.
+var pagerEraseRe = regexp.MustCompile(`(\x08+ *\x08*)|(\x1b\[\d+D *(\x1b\[\d+D)?)|(\r +\r)`)
+
+// pagerTail limita a parte final do buffer examinada: o marcador está
+// sempre na última linha, e examinar o buffer inteiro a cada leitura seria
+// quadrático em saídas grandes.
+const pagerTail = 256
+
+// pagerHandler detecta marcadores de paginação ("---- More ----",
+// "--More--") no fim do buffer, responde com espaço e remove o marcador.
+type pagerHandler struct {
+	patterns []*regexp.Regexp
+	w        io.Writer
+	hits     int
+}
+
+func newPagerHandler(patterns []string, w io.Writer) (*pagerHandler, error) {
+	p := &pagerHandler{w: w}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(`[ \t]*(?:` + pattern + `)[ \t]*$`)
+		if err != nil {
+			return nil, fmt.Errorf("padrão de paginação inválido %q: %w", pattern, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// Handle verifica se o buffer termina em um marcador de paginação. Se sim,
+// remove o marcador do buffer e envia espaço para continuar a saída.
+func (p *pagerHandler) Handle(buf *bytes.Buffer) (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	b := buf.Bytes()
+	start := bytes.LastIndexByte(b, '\n') + 1
+	start = max(start, len(b)-pagerTail)
+	for _, re := range p.patterns {
+		loc := re.FindIndex(b[start:])
+		if loc == nil {
+			continue
+		}
+		buf.Truncate(start + loc[0])
+		p.hits++
+		if _, err := p.w.Write([]byte(" ")); err != nil {
+			return true, fmt.Errorf("erro enviando espaço para paginação: %w", err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Clean remove as sequências de apagamento deixadas pela paginação. Só atua
+// se algum marcador foi encontrado.
+func (p *pagerHandler) Clean(output string) string {
+	if p == nil || p.hits == 0 {
+		return output
+	}
+	return pagerEraseRe.ReplaceAllString(output, "")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// promptMatcher reconhece o prompt do equipamento comparando apenas a última
+// linha do buffer, evitando falsos positivos com "<", ">" ou "#" no meio da
+// saída de um comando.
+type promptMatcher struct {
+	patterns []*regexp.Regexp
+	learned  string
+	hostname string
+}
+
+func newPromptMatcher(patterns []string) (*promptMatcher, error) {
+	m := &promptMatcher{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("prompt inválido %q: %w", p, err)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	if len(m.patterns) == 0 {
+		return nil, fmt.Errorf("nenhum padrão de prompt definido")
+	}
+	return m, nil
+}
+
+// Match informa se o buffer termina em um prompt. Depois que o prompt exato
+// foi aprendido, só são aceitos prompts que contenham o mesmo hostname (ex:
+// "<CORE01>" e "[CORE01]" no Huawei).
+func (m *promptMatcher) Match(output string) bool {
+	line := lastLine(output)
+	if line == "" {
+		return false
+	}
+	if m.learned != "" {
+		if line == m.learned {
+			return true
+		}
+		if !strings.Contains(line, m.hostname) {
+			return false
+		}
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Learn fixa o prompt exato (ex: "<CORE01>") a partir da saída recebida logo
+// após o login. Retorna false se a última linha não parece um prompt.
+func (m *promptMatcher) Learn(output string) bool {
+	if m.learned != "" || !m.Match(output) {
+		return false
+	}
+	m.learned = lastLine(output)
+	m.hostname = strings.Trim(m.learned, "<>[]#>%~*$ ")
+	return true
+}
+
+// LearnUnmatched é usado quando o prompt inicial não casou nenhum padrão
+// (ex: hostname com "@" ou espaço): se a última linha termina como um prompt
+// (">", "#", "]", "$" ou "%"), ela é fixada literalmente. Sem isso cada
+// comando só terminaria no timeout.
+func (m *promptMatcher) LearnUnmatched(output string) bool {
+	line := lastLine(output)
+	if m.learned != "" || line == "" || !strings.ContainsAny(line[len(line)-1:], ">#]$%") {
+		return false
+	}
+	m.learned = line
+	m.hostname = strings.Trim(line, "<>[]#>%~*$ ")
+	return true
+}
+
+func (m *promptMatcher) Learned() string {
+	return m.learned
+}
+
+// lastLine retorna a linha incompleta no fim do buffer; se a saída termina
+// em quebra de linha, ainda não há prompt.
+func lastLine(output string) string {
+	if i := strings.LastIndexByte(output, '\n'); i >= 0 {
+		output = output[i+1:]
+	}
+	return strings.TrimSpace(strings.ReplaceAll(output, "\r", ""))
+}
+
+func validatePromptPatterns(patterns []string) error {
+	for k, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("prompt_patterns[%d] vazio", k)
+		}
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("prompt_patterns[%d]: %w", k, err)
+		}
+	}
+	return nil
+}
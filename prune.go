@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RetentionConfig define quais coletas em base_dir são mantidas pelo
+// subcomando prune. Um diretório de dia é mantido se atender a qualquer
+// regra; keep_runs protege ainda as N coletas mais recentes de cada asset,
+// mesmo dentro de dias removidos.
+type RetentionConfig struct {
+	KeepDays    int `json:"keep_days,omitempty"`    // Dias mais recentes mantidos por inteiro
+	KeepRuns    int `json:"keep_runs,omitempty"`    // Coletas mais recentes mantidas por asset
+	KeepWeekly  int `json:"keep_weekly,omitempty"`  // Último dia de cada uma das N semanas mais recentes
+	KeepMonthly int `json:"keep_monthly,omitempty"` // Último dia de cada um dos N meses mais recentes
+}
+
+func (r *RetentionConfig) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.KeepDays < 0 || r.KeepRuns < 0 || r.KeepWeekly < 0 || r.KeepMonthly < 0 {
+		return errors.New("retention: valores não podem ser negativos")
+	}
+	if r.KeepDays == 0 && r.KeepRuns == 0 && r.KeepWeekly == 0 && r.KeepMonthly == 0 {
+		return errors.New("retention: configure keep_days, keep_runs, keep_weekly ou keep_monthly")
+	}
+	return nil
+}
+
+// prunedRun identifica uma coleta de um asset em um dia para keep_runs.
+type prunedRun struct {
+	day   string
+	time  time.Time
+	files []string
+}
+
+// planPrune lista os caminhos em baseDir que devem ser removidos segundo a
+// política de retenção.
+func planPrune(baseDir string, r *RetentionConfig, now time.Time) ([]string, error) {
+	days, err := listDayDirs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	keep := keptDays(days, r, now)
+
+	// Coletas por asset em todos os dias, para keep_runs
+	dayFiles := make(map[string][]string) // Arquivos de coletas de cada dia
+	runs := make(map[string][]prunedRun)
+	for _, day := range days {
+		captures, _, err := dayCaptures(filepath.Join(baseDir, day))
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range captures {
+			dayFiles[day] = append(dayFiles[day], c.files...)
+			runs[c.asset] = append(runs[c.asset], prunedRun{day: day, time: c.time, files: c.files})
+		}
+	}
+
+	protected := make(map[string]bool) // dia/arquivo
+	if r.KeepRuns > 0 {
+		for _, list := range runs {
+			sort.Slice(list, func(i, j int) bool {
+				return list[i].time.After(list[j].time)
+			})
+			for _, run := range list[:min(r.KeepRuns, len(list))] {
+				for _, f := range run.files {
+					protected[run.day+"/"+f] = true
+				}
+			}
+		}
+	}
+
+	var remove []string
+	for _, day := range days {
+		if keep[day] {
+			continue
+		}
+		var del []string
+		kept := 0
+		for _, f := range dayFiles[day] {
+			if protected[day+"/"+f] {
+				kept++
+				continue
+			}
+			del = append(del, filepath.Join(baseDir, day, f))
+		}
+		if kept == 0 {
+			remove = append(remove, filepath.Join(baseDir, day))
+			continue
+		}
+		// Com coletas protegidas o dia fica: remove apenas os arquivos das
+		// demais coletas, mantendo relatórios e o índice
+		remove = append(remove, del...)
+	}
+	return remove, nil
+}
+
+// keptDays aplica keep_days, keep_weekly e keep_monthly aos diretórios de
+// dia, ordenados do mais recente para o mais antigo.
+func keptDays(days []string, r *RetentionConfig, now time.Time) map[string]bool {
+	keep := make(map[string]bool)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	weeks := make(map[string]bool)
+	months := make(map[string]bool)
+
+	for _, day := range days {
+		t, _ := time.Parse("2006-01-02", day)
+		if r.KeepDays > 0 && today.Sub(t) < time.Duration(r.KeepDays)*24*time.Hour {
+			keep[day] = true
+		}
+
+		year, week := t.ISOWeek()
+		weekKey := fmt.Sprintf("%d-W%02d", year, week)
+		if !weeks[weekKey] && len(weeks) < r.KeepWeekly {
+			weeks[weekKey] = true
+			keep[day] = true
+		}
+
+		monthKey := t.Format("2006-01")
+		if !months[monthKey] && len(months) < r.KeepMonthly {
+			months[monthKey] = true
+			keep[day] = true
+		}
+	}
+	return keep
+}
+
+// runPrune implementa "collector prune [--dry-run] <targets.json>".
+func runPrune(args []string, logger *slog.Logger) int {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "apenas lista o que seria removido")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: collector prune [--dry-run] <targets.json>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 {
+		if err == nil {
+			fs.Usage()
+		}
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(fs.Arg(0))
+	if err != nil {
+		logger.Error("erro lendo config", "error", err)
+		return exitConfig
+	}
+	if cfg.Retention == nil {
+		logger.Error("retention não configurado", "config", fs.Arg(0))
+		return exitConfig
+	}
+	if err := cfg.Retention.Validate(); err != nil {
+		logger.Error("config inválida", "error", err)
+		return exitConfig
+	}
+	if cfg.BaseDir == "" {
+		cfg.BaseDir = "./coletas"
+	}
+
+	paths, err := planPrune(cfg.BaseDir, cfg.Retention, time.Now())
+	if err != nil {
+		logger.Error("erro planejando limpeza", "base_dir", cfg.BaseDir, "error", err)
+		return exitConfig
+	}
+
+	failed := 0
+	for _, p := range paths {
+		if *dryRun {
+			logger.Info("seria removido", "path", p)
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			failed++
+			logger.Error("erro removendo", "path", p, "error", err)
+			continue
+		}
+		logger.Info("removido", "path", p)
+	}
+
+	logger.Info("limpeza finalizada",
+		"base_dir", cfg.BaseDir,
+		"dry_run", *dryRun,
+		"paths", len(paths),
+		"errors", failed,
+	)
+	if failed > 0 {
+		return exitPartial
+	}
+	return exitOK
+}
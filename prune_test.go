@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pruneCapture descreve uma coleta criada no base_dir de teste. Coletas
+// legacy usam o nome NOME__IP__VENDOR__PROTO__HHMMSS e ficam fora do índice.
+type pruneCapture struct {
+	day    string // AAAA-MM-DD
+	asset  string
+	clock  string // HHMMSS
+	legacy bool
+	diff   bool // Grava também o .diff da coleta
+}
+
+// buildPruneBase cria as coletas em um base_dir temporário, com um
+// run-report.json em cada dia.
+func buildPruneBase(t *testing.T, captures []pruneCapture) string {
+	t.Helper()
+	base := t.TempDir()
+	for _, c := range captures {
+		dayDir := filepath.Join(base, c.day)
+		if err := os.MkdirAll(dayDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dayDir, "run-report.json"), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		ts, err := time.ParseInLocation("2006-01-02 150405", c.day+" "+c.clock, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := c.asset + "__10.0.0.1__huawei__ssh__" + c.clock
+		if !c.legacy {
+			name = c.asset + "__10.0.0.1__huawei__ssh__" + ts.Format("20060102-150405") + "__r" + c.clock
+		}
+		files := []string{name + ".txt"}
+		if c.diff {
+			files = append(files, name+".diff")
+		}
+		for _, f := range files {
+			if err := os.WriteFile(filepath.Join(dayDir, f), []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if c.legacy {
+			continue
+		}
+		err = appendCaptureIndex(dayDir, captureIndexEntry{
+			Asset:    c.asset,
+			Address:  "10.0.0.1",
+			Vendor:   "huawei",
+			Protocol: "ssh",
+			RunID:    "r" + c.clock,
+			Time:     ts,
+			Capture:  name + ".txt",
+			Files:    files,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return base
+}
+
+func TestPlanPrune(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name      string
+		retention RetentionConfig
+		captures  []pruneCapture
+		remove    []string // Relativos ao base_dir
+	}{
+		{
+			name:      "keep_runs protege coletas em dias expirados",
+			retention: RetentionConfig{KeepDays: 1, KeepRuns: 2},
+			captures: []pruneCapture{
+				{day: "2026-03-10", asset: "sw1", clock: "080000"},
+				{day: "2026-03-01", asset: "sw1", clock: "090000"},
+				{day: "2026-03-01", asset: "sw1", clock: "080000", diff: true},
+				{day: "2026-03-01", asset: "sw2", clock: "080000"},
+				{day: "2026-02-01", asset: "sw1", clock: "080000"},
+			},
+			remove: []string{
+				"2026-02-01",
+				"2026-03-01/sw1__10.0.0.1__huawei__ssh__20260301-080000__r080000.diff",
+				"2026-03-01/sw1__10.0.0.1__huawei__ssh__20260301-080000__r080000.txt",
+			},
+		},
+		{
+			name:      "keep_weekly mantém o último dia de cada semana ISO",
+			retention: RetentionConfig{KeepWeekly: 2},
+			captures: []pruneCapture{
+				{day: "2026-03-09", asset: "sw1", clock: "080000"}, // Segunda, W11
+				{day: "2026-03-08", asset: "sw1", clock: "080000"}, // Domingo, W10
+				{day: "2026-03-07", asset: "sw1", clock: "080000"}, // Sábado, W10
+				{day: "2026-03-01", asset: "sw1", clock: "080000"}, // Domingo, W09
+			},
+			remove: []string{"2026-03-01", "2026-03-07"},
+		},
+		{
+			name:      "keep_monthly mantém o último dia de cada mês",
+			retention: RetentionConfig{KeepMonthly: 2},
+			captures: []pruneCapture{
+				{day: "2026-03-02", asset: "sw1", clock: "080000"},
+				{day: "2026-02-28", asset: "sw1", clock: "080000"},
+				{day: "2026-02-01", asset: "sw1", clock: "080000"},
+				{day: "2026-01-31", asset: "sw1", clock: "080000"},
+			},
+			remove: []string{"2026-01-31", "2026-02-01"},
+		},
+		{
+			name:      "coletas HHMMSS fora do índice entram em keep_runs pelo horário",
+			retention: RetentionConfig{KeepDays: 1, KeepRuns: 1},
+			captures: []pruneCapture{
+				{day: "2026-03-05", asset: "sw1", clock: "235900", legacy: true, diff: true},
+				{day: "2026-03-05", asset: "sw1", clock: "080000"},
+				{day: "2026-03-04", asset: "sw1", clock: "120000", legacy: true},
+			},
+			remove: []string{
+				"2026-03-04",
+				"2026-03-05/sw1__10.0.0.1__huawei__ssh__20260305-080000__r080000.txt",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := buildPruneBase(t, tt.captures)
+			paths, err := planPrune(base, &tt.retention, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range paths {
+				rel, err := filepath.Rel(base, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.remove) {
+				t.Errorf("removidos:\n  %s\nesperado:\n  %s", strings.Join(got, "\n  "), strings.Join(tt.remove, "\n  "))
+			}
+		})
+	}
+}
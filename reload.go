@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// loadValidConfig lê, valida e aplica os defaults do arquivo de targets.
+func loadValidConfig(path string) (*Config, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+	return cfg, nil
+}
+
+// watchConfig chama reload no SIGHUP e, se interval > 0, quando o horário
+// de modificação ou o tamanho do arquivo mudarem. Retorna quando ctx é
+// cancelado.
+func watchConfig(ctx context.Context, path string, interval time.Duration, logger *slog.Logger, reload func(reason string)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	last, _ := os.Stat(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			last, _ = os.Stat(path)
+			reload("sighup")
+		case <-tick:
+			info, err := os.Stat(path)
+			if err != nil {
+				logger.Warn("erro verificando arquivo de targets", "path", path, "error", err)
+				continue
+			}
+			if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+			reload("arquivo alterado")
+		}
+	}
+}
+
+// reloadConfig relê o arquivo de targets do collector e, se válido e se
+// apply não falhar, passa a usá-lo nas próximas execuções. Registra os
+// assets adicionados, removidos e alterados.
+func reloadConfig(c *collector, reason string, apply func(*collectorState) error) (*collectorState, error) {
+	cfg, err := loadValidConfig(c.cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	old := c.current().cfg
+	st, err := c.swap(cfg, apply)
+	if err != nil {
+		return nil, err
+	}
+
+	added, removed, changed := diffAssets(old, cfg)
+	c.logger.Info("config recarregada",
+		"reason", reason,
+		"added", added,
+		"removed", removed,
+		"changed", changed,
+	)
+
+	// Definidos na inicialização do processo
+	if cfg.Concurrency != old.Concurrency {
+		c.logger.Warn("concurrency alterada, reinicie o serviço para aplicar", "running", c.poolSize, "configured", cfg.Concurrency)
+	}
+	if !reflect.DeepEqual(cfg.API, old.API) {
+		c.logger.Warn("api alterada, reinicie o serviço para aplicar")
+	}
+	if !reflect.DeepEqual(cfg.Metrics, old.Metrics) {
+		c.logger.Warn("metrics alterado, reinicie o serviço para aplicar")
+	}
+	return st, nil
+}
+
+// diffAssets compara os assets (por nome e endereço) de duas configurações.
+// Um asset é alterado se ele, o seu grupo ou as configurações globais que
+// se aplicam a ele mudaram.
+func diffAssets(old, cur *Config) (added, removed, changed []string) {
+	before := assetFingerprints(old)
+	after := assetFingerprints(cur)
+	for name, fp := range after {
+		prev, ok := before[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case prev != fp:
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// assetFingerprints resume, por assetKey, tudo o que define a coleta de
+// cada asset: o asset, o grupo e as configurações globais já resolvidas
+// (perfil de criptografia, timeout, saída e política de host key).
+func assetFingerprints(cfg *Config) map[string]string {
+	fps := make(map[string]string)
+	for _, g := range cfg.Groups {
+		group := g
+		group.Assets = nil
+		for _, a := range g.Assets {
+			data, _ := json.Marshal(struct {
+				Group          Group
+				Asset          Asset
+				SSHLegacy      *SSHLegacy
+				TimeoutSeconds int
+				MaxRetries     int
+				Output         OutputConfig
+				HostKeyPolicy  string
+				KnownHostsFile string
+				LegacyFallback *bool
+				ConfigDiff     *bool
+				GitArchive     *GitArchiveConfig
+			}{
+				Group:          group,
+				Asset:          a,
+				SSHLegacy:      cfg.resolveSSHLegacy(g, a),
+				TimeoutSeconds: cfg.TimeoutSeconds,
+				MaxRetries:     cfg.MaxRetries,
+				Output:         cfg.Output,
+				HostKeyPolicy:  cfg.HostKeyPolicy,
+				KnownHostsFile: cfg.KnownHostsFile,
+				LegacyFallback: cfg.LegacyFallback,
+				ConfigDiff:     cfg.ConfigDiff,
+				GitArchive:     cfg.GitArchive,
+			})
+			key := assetKey(a.Name, a.Address)
+			if _, dup := fps[key]; dup {
+				// Mesmo asset em mais de um grupo
+				key = g.DisplayName() + "/" + key
+			}
+			fps[key] = string(data)
+		}
+	}
+	return fps
+}
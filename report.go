@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status possíveis de um asset no relatório.
+const (
+	statusSuccess   = "success"
+	statusFailed    = "failed"
+	statusSkipped   = "skipped"
+	statusInactive  = "inactive"
+	statusCancelled = "cancelled"
+)
+
+// JobResult é o resultado de um asset na execução.
+type JobResult struct {
+	Asset          string    `json:"asset"`
+	Address        string    `json:"address"`
+	Vendor         string    `json:"vendor"`
+	Protocol       string    `json:"protocol,omitempty"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	StartedAt      time.Time `json:"started_at,omitzero"`
+	DurationMs     int64     `json:"duration_ms"`
+	OutputFile     string    `json:"output_file,omitempty"`
+	JSONFile       string    `json:"json_file,omitempty"`
+	SplitDir       string    `json:"split_dir,omitempty"`    // output.mode split/both
+	ArchiveFile    string    `json:"archive_file,omitempty"` // Caminho no git_archive
+	Bytes          int       `json:"bytes"`
+	LegacyFallback bool      `json:"legacy_fallback,omitempty"`
+	ConfigSHA256   string    `json:"config_sha256,omitempty"`  // Configuração normalizada sem linhas voláteis
+	ConfigChanged  *bool     `json:"config_changed,omitempty"` // nil: sem coleta anterior para comparar
+	PreviousFile   string    `json:"previous_file,omitempty"`
+	DiffFile       string    `json:"diff_file,omitempty"`
+	ErrorClass     string    `json:"error_class,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// RunTotals resume a execução por status.
+type RunTotals struct {
+	Assets    int `json:"assets"`
+	Success   int `json:"success"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+	Inactive  int `json:"inactive"`
+	Cancelled int `json:"cancelled"`
+	Changed   int `json:"config_changed"`
+	Bytes     int `json:"bytes"`
+}
+
+// RunReport é gravado como run-report.json no diretório do dia.
+type RunReport struct {
+	RunID      string      `json:"run_id"`
+	Trigger    string      `json:"trigger,omitempty"` // "schedule", "api" (vazio no modo one-shot)
+	Config     string      `json:"config"`
+	OutputDir  string      `json:"output_dir"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	DurationMs int64       `json:"duration_ms"`
+	Totals     RunTotals   `json:"totals"`
+	Assets     []JobResult `json:"assets"`
+
+	// Commit gravado no git_archive e assets alterados nele
+	ArchiveCommit  string   `json:"archive_commit,omitempty"`
+	ArchiveChanged []string `json:"archive_changed,omitempty"`
+
+	mu sync.Mutex
+}
+
+func newRunReport(cfgPath, outDir string) *RunReport {
+	return &RunReport{
+		RunID:     newRunID(),
+		Config:    cfgPath,
+		OutputDir: outDir,
+		StartedAt: time.Now(),
+	}
+}
+
+// newRunID gera o identificador curto da execução, usado no nome dos
+// arquivos e no índice de coletas.
+func newRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Add registra o resultado de um asset; seguro para uso pelos workers.
+func (r *RunReport) Add(res JobResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Assets = append(r.Assets, res)
+}
+
+// Snapshot copia o relatório para consulta enquanto a execução está em
+// andamento.
+func (r *RunReport) Snapshot() *RunReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &RunReport{
+		RunID:          r.RunID,
+		Trigger:        r.Trigger,
+		Config:         r.Config,
+		OutputDir:      r.OutputDir,
+		StartedAt:      r.StartedAt,
+		FinishedAt:     r.FinishedAt,
+		DurationMs:     r.DurationMs,
+		Totals:         r.Totals,
+		Assets:         append([]JobResult(nil), r.Assets...),
+		ArchiveCommit:  r.ArchiveCommit,
+		ArchiveChanged: r.ArchiveChanged,
+	}
+}
+
+// SetArchiveCommit registra o commit gravado no git_archive.
+func (r *RunReport) SetArchiveCommit(hash string, changed []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ArchiveCommit = hash
+	r.ArchiveChanged = changed
+}
+
+// Finish fecha o relatório e calcula os totais.
+func (r *RunReport) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = time.Now()
+	r.DurationMs = r.FinishedAt.Sub(r.StartedAt).Milliseconds()
+	r.Totals = RunTotals{Assets: len(r.Assets)}
+	for _, a := range r.Assets {
+		r.Totals.Bytes += a.Bytes
+		if a.ConfigChanged != nil && *a.ConfigChanged {
+			r.Totals.Changed++
+		}
+		switch a.Status {
+		case statusSuccess:
+			r.Totals.Success++
+		case statusFailed:
+			r.Totals.Failed++
+		case statusSkipped:
+			r.Totals.Skipped++
+		case statusInactive:
+			r.Totals.Inactive++
+		case statusCancelled:
+			r.Totals.Cancelled++
+		}
+	}
+}
+
+// Write grava <name>.json (e <name>.csv, se pedido) em dir.
+func (r *RunReport) Write(dir, name string, withCSV bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeAtomic(filepath.Join(dir, name+".json"), append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	if !withCSV {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"asset", "address", "vendor", "protocol", "status", "attempts", "started_at", "duration_ms",
+		"output_file", "json_file", "split_dir", "archive_file", "bytes", "legacy_fallback", "config_sha256", "config_changed", "diff_file", "error_class", "error"})
+	for _, a := range r.Assets {
+		started := ""
+		if !a.StartedAt.IsZero() {
+			started = a.StartedAt.Format(time.RFC3339)
+		}
+		changed := ""
+		if a.ConfigChanged != nil {
+			changed = strconv.FormatBool(*a.ConfigChanged)
+		}
+		_ = w.Write([]string{a.Asset, a.Address, a.Vendor, a.Protocol, a.Status, strconv.Itoa(a.Attempts), started,
+			strconv.FormatInt(a.DurationMs, 10), a.OutputFile, a.JSONFile, a.SplitDir, a.ArchiveFile, strconv.Itoa(a.Bytes),
+			strconv.FormatBool(a.LegacyFallback), a.ConfigSHA256, changed, a.DiffFile, a.ErrorClass, a.Error})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(dir, name+".csv"), buf.Bytes(), 0o644)
+}
+
+// classifyError agrupa erros em classes estáveis para alertas e métricas.
+func classifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) {
+		return "cancelled"
+	}
+	if errors.Is(err, ErrHostKeyMismatch) {
+		return "host_key_mismatch"
+	}
+
+	msg := err.Error()
+	var netErr net.Error
+	switch {
+	case strings.Contains(msg, "unable to authenticate"), strings.Contains(msg, "ssh auth:"):
+		return "auth"
+	case isNoCommonAlgorithm(err):
+		return "no_common_algorithm"
+	case strings.Contains(msg, "connection refused"):
+		return "connection_refused"
+	case errors.As(err, &netErr) && netErr.Timeout(), strings.Contains(msg, "timeout"):
+		return "timeout"
+	case strings.Contains(msg, "dial tcp:"), strings.Contains(msg, "dial telnet:"):
+		return "connect"
+	case strings.Contains(msg, "ssh handshake:"):
+		return "handshake"
+	default:
+		return "other"
+	}
+}
+
+// Códigos de saída do processo. 1 e 2 continuam reservados para erros de
+// configuração e de uso.
+const (
+	exitOK        = 0
+	exitConfig    = 1
+	exitUsage     = 2
+	exitPartial   = 3 // Parte dos assets falhou acima do --fail-threshold
+	exitAllFailed = 4 // Nenhum asset coletado com sucesso
+	exitCancelled = 5 // Interrompido por SIGINT/SIGTERM
+)
+
+// ExitCode traduz os totais em código de saída. failThreshold é a
+// porcentagem de falhas tolerada (0-100) entre os assets ativos; assets sem
+// senha configurada contam como falha. Se nenhum asset foi coletado, o
+// código é exitAllFailed qualquer que seja o limite. Chamar após Finish.
+func (r *RunReport) ExitCode(failThreshold float64, cancelled bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cancelled || r.Totals.Cancelled > 0 {
+		return exitCancelled
+	}
+	failures := r.Totals.Failed + r.Totals.Skipped
+	attempted := r.Totals.Success + failures
+	if failures == 0 || attempted == 0 {
+		return exitOK
+	}
+	if r.Totals.Success == 0 {
+		return exitAllFailed
+	}
+	if float64(failures)*100/float64(attempted) <= failThreshold {
+		return exitOK
+	}
+	return exitPartial
+}
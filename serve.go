@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// validateSchedule aceita expressões cron de 5 campos e descritores como
+// "@hourly" e "@daily"; vazio desabilita o agendamento do grupo.
+func validateSchedule(spec string) error {
+	if strings.TrimSpace(spec) == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return fmt.Errorf("schedule inválido %q: %w", spec, err)
+	}
+	return nil
+}
+
+// runServe implementa o subcomando serve (alias daemon): mantém o pool de
+// workers ativo e dispara uma coleta de cada grupo conforme o seu schedule
+// e, se configurada, pela API HTTP. Um asset cuja coleta anterior ainda
+// está em andamento é ignorado na execução seguinte. O arquivo de targets
+// é recarregado no SIGHUP ou quando muda. SIGINT/SIGTERM cancelam as
+// coletas em andamento, que gravam o relatório antes do processo sair.
+func runServe(args []string, logger *slog.Logger) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	reloadInterval := fs.Duration("reload-interval", 10*time.Second, "intervalo de verificação de mudanças no arquivo de targets (0 desabilita; SIGHUP sempre recarrega)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: collector serve [--reload-interval 10s] <targets.json>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cfgPath := fs.Arg(0)
+	cfg, err := loadValidConfig(cfgPath)
+	if err != nil {
+		logger.Error("config inválida", "error", err)
+		return exitConfig
+	}
+
+	c, err := newCollector(cfgPath, cfg, logger)
+	if err != nil {
+		logger.Error("erro preparando coleta", "error", err)
+		return exitConfig
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelOnSignal(cancel, logger)
+
+	sched := cron.New()
+	entries, err := scheduleGroups(sched, c, c.current(), logger)
+	if err != nil {
+		logger.Error("config inválida", "error", err)
+		return exitConfig
+	}
+	if len(entries) == 0 && cfg.API == nil {
+		logger.Error("nenhum grupo com schedule definido e api não configurada")
+		return exitConfig
+	}
+
+	var api *apiServer
+	var ln net.Listener
+	if cfg.API != nil {
+		api, err = newAPIServer(c, cfg.API, logger)
+		if err != nil {
+			logger.Error("config inválida", "error", err)
+			return exitConfig
+		}
+		ln, err = net.Listen("tcp", cfg.API.Listen)
+		if err != nil {
+			logger.Error("erro abrindo porta da API", "listen", cfg.API.Listen, "error", err)
+			return exitConfig
+		}
+	}
+	var metricsLn net.Listener
+	if cfg.Metrics != nil && cfg.Metrics.Listen != "" {
+		metricsLn, err = net.Listen("tcp", cfg.Metrics.Listen)
+		if err != nil {
+			logger.Error("erro abrindo porta de métricas", "listen", cfg.Metrics.Listen, "error", err)
+			return exitConfig
+		}
+	}
+
+	c.start(ctx)
+	sched.Start()
+	apiStopped := make(<-chan struct{})
+	if api != nil {
+		apiStopped = serveHTTP(ctx, ln, api.handler(), logger)
+		logger.Info("API HTTP iniciada", "listen", ln.Addr().String())
+	}
+	if metricsLn != nil {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.handler())
+		serveHTTP(ctx, metricsLn, mux, logger)
+		logger.Info("métricas disponíveis", "listen", metricsLn.Addr().String(), "path", "/metrics")
+	}
+	logger.Info("modo serve iniciado", "config", cfgPath, "groups", len(entries), "concurrency", cfg.Concurrency)
+
+	// Reload: troca a configuração e refaz os agendamentos; as coletas em
+	// andamento terminam com a configuração anterior
+	// Os novos agendamentos são criados antes da troca: se falharem, API e
+	// cron continuam juntos na configuração anterior
+	watchConfig(ctx, cfgPath, *reloadInterval, logger, func(reason string) {
+		var newEntries []cron.EntryID
+		_, err := reloadConfig(c, reason, func(st *collectorState) error {
+			var err error
+			newEntries, err = scheduleGroups(sched, c, st, logger)
+			return err
+		})
+		if err != nil {
+			logger.Error("config recarregada inválida, mantendo a anterior", "reason", reason, "error", err)
+			return
+		}
+		for _, id := range entries {
+			sched.Remove(id)
+		}
+		entries = newEntries
+	})
+
+	// Não agenda nem aceita novas execuções e aguarda as que estão em
+	// andamento gravarem os relatórios
+	if api != nil {
+		api.close()
+	}
+	<-sched.Stop().Done()
+	if api != nil {
+		<-apiStopped
+		api.wait()
+	}
+	c.stop()
+	logger.Info("modo serve finalizado")
+	return exitOK
+}
+
+// scheduleGroups agenda uma coleta por grupo com schedule de st.cfg.
+func scheduleGroups(sched *cron.Cron, c *collector, st *collectorState, logger *slog.Logger) ([]cron.EntryID, error) {
+	var entries []cron.EntryID
+	for gi, g := range st.cfg.Groups {
+		name := g.DisplayName()
+		if strings.TrimSpace(g.Schedule) == "" {
+			logger.Warn("grupo sem schedule, não será coletado no modo serve", "group", name)
+			continue
+		}
+		id, err := sched.AddFunc(g.Schedule, func() {
+			report, err := c.runWith(st, runOptions{Groups: []int{gi}, Trigger: "schedule", PerRunReport: true})
+			if err != nil {
+				logger.Error("erro iniciando coleta agendada", "group", name, "error", err)
+				return
+			}
+			logger.Info("coleta agendada finalizada",
+				"group", name,
+				"run_id", report.RunID,
+				"success", report.Totals.Success,
+				"failed", report.Totals.Failed,
+				"skipped", report.Totals.Skipped,
+				"cancelled", report.Totals.Cancelled,
+				"config_changed", report.Totals.Changed,
+				"duration_ms", report.DurationMs,
+			)
+		})
+		if err != nil {
+			for _, id := range entries {
+				sched.Remove(id)
+			}
+			return nil, fmt.Errorf("grupo %s: %w", name, err)
+		}
+		entries = append(entries, id)
+		logger.Info("grupo agendado", "group", name, "schedule", g.Schedule, "assets", len(g.Assets))
+	}
+	return entries, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Métodos de autenticação SSH aceitos em auth_methods.
+const (
+	authPublicKey           = "publickey"
+	authAgent               = "agent"
+	authKeyboardInteractive = "keyboard-interactive"
+	authPassword            = "password"
+)
+
+var defaultAuthMethods = []string{authPublicKey, authAgent, authKeyboardInteractive, authPassword}
+
+// SSHAuth reúne as credenciais SSH já resolvidas (asset override ou grupo).
+type SSHAuth struct {
+	PrivateKeyFile string
+	Passphrase     string
+	UseAgent       bool
+	Methods        []string
+}
+
+// HasNonPassword informa se há algum método que dispensa senha.
+func (a SSHAuth) HasNonPassword() bool {
+	return a.PrivateKeyFile != "" || a.UseAgent
+}
+
+// buildSSHAuthMethods monta os métodos na ordem configurada. Chave privada e
+// agent são combinados em um único método publickey, pois o cliente SSH não
+// tenta o mesmo tipo de método duas vezes. A função retornada fecha a conexão
+// com o agent.
+func buildSSHAuthMethods(auth SSHAuth, password string, logger *slog.Logger) ([]ssh.AuthMethod, func(), error) {
+	closeFn := func() {}
+
+	methods := auth.Methods
+	if len(methods) == 0 {
+		methods = defaultAuthMethods
+	}
+
+	var signers []ssh.Signer
+	var keyErr error
+	if auth.PrivateKeyFile != "" && slices.Contains(methods, authPublicKey) {
+		signer, err := loadPrivateKey(auth.PrivateKeyFile, auth.Passphrase)
+		if err != nil {
+			keyErr = err
+		} else {
+			signers = append(signers, signer)
+		}
+	}
+
+	var agentSigners func() ([]ssh.Signer, error)
+	if auth.UseAgent && slices.Contains(methods, authAgent) {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, closeFn, errors.New("use_ssh_agent habilitado mas SSH_AUTH_SOCK não definido")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, closeFn, fmt.Errorf("conectando ao ssh-agent: %w", err)
+		}
+		closeFn = func() { _ = conn.Close() }
+		agentSigners = agent.NewClient(conn).Signers
+	}
+
+	var result []ssh.AuthMethod
+	publicKeyAdded := false
+	for _, m := range methods {
+		switch m {
+		case authPublicKey, authAgent:
+			if publicKeyAdded || (len(signers) == 0 && agentSigners == nil) {
+				continue
+			}
+			publicKeyAdded = true
+			result = append(result, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				all := append([]ssh.Signer{}, signers...)
+				if agentSigners != nil {
+					fromAgent, err := agentSigners()
+					if err != nil && len(all) == 0 {
+						return nil, err
+					}
+					all = append(all, fromAgent...)
+				}
+				return all, nil
+			}))
+		case authKeyboardInteractive:
+			if password != "" {
+				result = append(result, ssh.KeyboardInteractive(keyboardInteractiveResponder(password)))
+			}
+		case authPassword:
+			if password != "" {
+				result = append(result, ssh.Password(password))
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		closeFn()
+		if keyErr != nil {
+			return nil, func() {}, keyErr
+		}
+		return nil, func() {}, errors.New("nenhum método de autenticação SSH disponível")
+	}
+	if keyErr != nil {
+		logger.Warn("chave privada ignorada", "error", keyErr)
+	}
+	return result, closeFn, nil
+}
+
+func loadPrivateKey(path, passphrase string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lendo private_key_file: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == "" {
+			return nil, fmt.Errorf("chave %s protegida por senha: configure private_key_passphrase_env", path)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("chave privada %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// keyboardInteractiveResponder responde com a senha apenas às perguntas que
+// pedem senha (RADIUS/TACACS). Outras perguntas, como OTP ou token, abortam
+// o método com erro em vez de receber a senha.
+func keyboardInteractiveResponder(password string) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, q := range questions {
+			if !isPasswordPrompt(q) {
+				return nil, fmt.Errorf("keyboard-interactive: pergunta não suportada %q", strings.TrimSpace(q))
+			}
+			answers[i] = password
+		}
+		return answers, nil
+	}
+}
+
+// passwordPromptWords identificam perguntas keyboard-interactive de senha.
+var passwordPromptWords = []string{"password", "passwd", "senha"}
+
+func isPasswordPrompt(q string) bool {
+	lq := strings.ToLower(q)
+	for _, w := range passwordPromptWords {
+		if strings.Contains(lq, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateAuthMethods(methods []string) error {
+	seen := make(map[string]bool)
+	for k, m := range methods {
+		switch m {
+		case authPublicKey, authAgent, authKeyboardInteractive, authPassword:
+		default:
+			return fmt.Errorf("auth_methods[%d]: método inválido %q (use %s)", k, m, strings.Join(defaultAuthMethods, ", "))
+		}
+		if seen[m] {
+			return fmt.Errorf("auth_methods[%d]: método duplicado %q", k, m)
+		}
+		seen[m] = true
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VendorDriver descreve como coletar de um fabricante: comandos, prompts
+// (expressões regulares aplicadas à última linha recebida), desabilitação de
+// paginação, particularidades de login e comando de saída. ConfigCommand é o
+// comando cuja saída é a configuração completa, usada na comparação entre
+// coletas; VolatilePatterns são as linhas dessa saída que mudam a cada coleta
+// e são ignoradas no hash e no diff.
+type VendorDriver interface {
+	Name() string
+	PagerDisableCommand() string
+	Commands() []string
+	ConfigCommand() string
+	VolatilePatterns() []string
+	Prompts() []string
+	PagerPatterns() []string
+	Login() LoginQuirks
+	ExitCommand() string
+}
+
+// LoginQuirks agrupa os padrões usados no login via telnet e os comandos
+// enviados logo após autenticar, antes da desabilitação de paginação (ex:
+// "terminal width 0", para que linhas longas da configuração não sejam
+// quebradas).
+type LoginQuirks struct {
+	UsernamePrompts []string
+	PasswordPrompts []string
+	PostLogin       []string
+}
+
+var (
+	vendorMu       sync.RWMutex
+	vendorRegistry = map[string]VendorDriver{}
+)
+
+// RegisterVendor adiciona um driver ao registro. Um segundo registro com o
+// mesmo nome substitui o anterior.
+func RegisterVendor(d VendorDriver) {
+	vendorMu.Lock()
+	defer vendorMu.Unlock()
+	vendorRegistry[normalizeVendor(d.Name())] = d
+}
+
+func lookupVendor(name string) (VendorDriver, bool) {
+	vendorMu.RLock()
+	defer vendorMu.RUnlock()
+	d, ok := vendorRegistry[normalizeVendor(name)]
+	return d, ok
+}
+
+func vendorNames() []string {
+	vendorMu.RLock()
+	defer vendorMu.RUnlock()
+	names := make([]string, 0, len(vendorRegistry))
+	for name := range vendorRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func normalizeVendor(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// collectCommands retorna a sequência completa enviada ao equipamento:
+// desabilitação de paginação seguida dos comandos de coleta.
+func collectCommands(d VendorDriver, commands []string) []string {
+	cmds := make([]string, 0, len(commands)+1)
+	if pager := d.PagerDisableCommand(); pager != "" {
+		cmds = append(cmds, pager)
+	}
+	return append(cmds, commands...)
+}
+
+// staticDriver implementa VendorDriver a partir de valores fixos, o que
+// cobre os fabricantes suportados hoje.
+type staticDriver struct {
+	name     string
+	pager    string
+	commands []string
+	config   string
+	volatile []string
+	prompts  []string
+	pagers   []string
+	login    LoginQuirks
+	exit     string
+}
+
+func (d *staticDriver) Name() string                { return d.name }
+func (d *staticDriver) PagerDisableCommand() string { return d.pager }
+func (d *staticDriver) Commands() []string          { return d.commands }
+func (d *staticDriver) ConfigCommand() string       { return d.config }
+func (d *staticDriver) VolatilePatterns() []string  { return d.volatile }
+func (d *staticDriver) Prompts() []string           { return d.prompts }
+func (d *staticDriver) PagerPatterns() []string     { return d.pagers }
+func (d *staticDriver) ExitCommand() string         { return d.exit }
+
+func (d *staticDriver) Login() LoginQuirks {
+	l := d.login
+	if len(l.UsernamePrompts) == 0 {
+		l.UsernamePrompts = []string{"sername:", "ogin:"}
+	}
+	if len(l.PasswordPrompts) == 0 {
+		l.PasswordPrompts = []string{"assword:"}
+	}
+	return l
+}
+
+func init() {
+	RegisterVendor(&staticDriver{
+		name:  "huawei",
+		pager: "screen-length 0 temporary",
+		commands: []string{
+			"display version",
+			"display license",
+			"display current-configuration",
+			"display interface brief",
+			"display interface description",
+			"display interface transceiver",
+			"display lldp neighbor",
+			"display eth-trunk brief",
+			"display bgp peer",
+			"display ospf peer",
+			"display isis peer",
+		},
+		config: "display current-configuration",
+		volatile: []string{
+			`^\s*!\s*Last configuration was (updated|saved) at`,
+			`^\s*!\s*Time:`,
+			`(?i)uptime is`,
+			`^\s*ntp-service clock-period \d+\s*$`,
+		},
+		prompts: []string{`^<[\w.\-/:]+>$`, `^\[[~*]?[\w.\-/:]+\]$`},
+		pagers:  []string{`-{2,} ?More ?-{2,}`},
+		exit:    "quit",
+	})
+
+	RegisterVendor(&staticDriver{
+		name:  "zte",
+		pager: "terminal length 0",
+		commands: []string{
+			"show version",
+			"show license",
+			"show hardware",
+			"show running-config",
+			"show interface brief",
+			"show interface description",
+			"show lldp neighbor",
+			"show opticalinfo brief",
+			"show temperature detail",
+			"show interface summary",
+			"show ip bgp summary",
+			"show ip ospf neighbor",
+			"show isis topology",
+		},
+		config: "show running-config",
+		volatile: []string{
+			`^Building configuration`,
+			`^\s*!\s*Time:`,
+			`^\s*!\s*Last configuration was (updated|saved) at`,
+			`(?i)uptime is`,
+			`^\s*ntp clock-period \d+\s*$`,
+		},
+		prompts: []string{`^[\w.\-/:]+(\([\w.\-]+\))?[#>]$`},
+		pagers:  []string{`--More--`, `----More----`},
+		exit:    "quit",
+	})
+
+	RegisterVendor(&staticDriver{
+		name:  "cisco_ios",
+		pager: "terminal length 0",
+		commands: []string{
+			"show version",
+			"show inventory",
+			"show running-config",
+			"show ip interface brief",
+			"show interfaces description",
+			"show cdp neighbors detail",
+			"show lldp neighbors",
+			"show etherchannel summary",
+			"show ip bgp summary",
+			"show ip ospf neighbor",
+		},
+		config: "show running-config",
+		volatile: []string{
+			`^Building configuration`,
+			`^Current configuration : \d+ bytes`,
+			`^! Last configuration change at`,
+			`^! NVRAM config last updated at`,
+			`^! No configuration change since last restart`,
+			`^ntp clock-period`,
+		},
+		prompts: []string{`^[\w.\-/:]+(\([\w.\-]+\))?[#>]$`},
+		pagers:  []string{`--More--`},
+		login:   LoginQuirks{PostLogin: []string{"terminal width 0"}},
+		exit:    "exit",
+	})
+
+	RegisterVendor(&staticDriver{
+		name:  "junos",
+		pager: "set cli screen-length 0",
+		commands: []string{
+			"show version",
+			"show chassis hardware",
+			"show configuration",
+			"show interfaces terse",
+			"show interfaces descriptions",
+			"show lldp neighbors",
+			"show lacp interfaces",
+			"show bgp summary",
+			"show ospf neighbor",
+			"show isis adjacency",
+		},
+		config: "show configuration",
+		volatile: []string{
+			`^## Last (commit|changed): `,
+		},
+		prompts: []string{`^[\w.\-]+@[\w.\-:~/]+ ?[>#%]$`},
+		pagers:  []string{`---\(more( \d+%)?\)---`},
+		login:   LoginQuirks{PostLogin: []string{"set cli screen-width 0"}},
+		exit:    "exit",
+	})
+
+	RegisterVendor(&staticDriver{
+		name:  "arista_eos",
+		pager: "terminal length 0",
+		commands: []string{
+			"show version",
+			"show inventory",
+			"show running-config",
+			"show ip interface brief",
+			"show interfaces description",
+			"show lldp neighbors",
+			"show port-channel summary",
+			"show ip bgp summary",
+			"show ip ospf neighbor",
+		},
+		config: "show running-config",
+		volatile: []string{
+			`^! Time:`,
+		},
+		prompts: []string{`^[\w.\-/:]+(\([\w.\-]+\))?[#>]$`},
+		pagers:  []string{`--More--`},
+		exit:    "exit",
+	})
+}
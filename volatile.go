@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// lineFilter descarta linhas voláteis (timestamps, uptime, relógio NTP) que
+// mudam a cada coleta sem que a configuração tenha mudado.
+type lineFilter struct {
+	patterns []*regexp.Regexp
+}
+
+func newLineFilter(patterns []string) (*lineFilter, error) {
+	f := &lineFilter{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("ignore_pattern inválido %q: %w", p, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f, nil
+}
+
+// Filter remove as linhas que casam algum padrão.
+func (f *lineFilter) Filter(lines []string) []string {
+	if f == nil || len(f.patterns) == 0 {
+		return lines
+	}
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if !f.ignored(line) {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+func (f *lineFilter) ignored(line string) bool {
+	for _, re := range f.patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveIgnorePatterns soma aos padrões do vendor os ignore_patterns do
+// grupo e do asset.
+func resolveIgnorePatterns(driver VendorDriver, g Group, a Asset) []string {
+	patterns := append([]string{}, driver.VolatilePatterns()...)
+	patterns = append(patterns, g.IgnorePatterns...)
+	return append(patterns, a.IgnorePatterns...)
+}
+
+func validateIgnorePatterns(patterns []string) error {
+	for k, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("ignore_patterns[%d] vazio", k)
+		}
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("ignore_patterns[%d]: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// configHash calcula o SHA-256 da configuração (saída do ConfigCommand do
+// vendor) já normalizada e sem as linhas voláteis. Retorna "" se o comando
+// de configuração não fez parte da coleta ou não terminou (timeout, erro):
+// o hash de uma saída parcial não identifica a configuração.
+func configHash(c *capture, driver VendorDriver, ignore *lineFilter) string {
+	cmd := c.configCommand(driver)
+	if cmd == nil || !cmd.complete() {
+		return ""
+	}
+	lines := ignore.Filter(configLines(strings.Trim(cmd.Output, "\n")))
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}